@@ -1,8 +1,8 @@
 package discgo
 
 import (
+	"bytes"
 	"encoding/json"
-	"os"
 	"testing"
 )
 
@@ -33,17 +33,11 @@ func TestClient_GetChannelMessage(t *testing.T) {
 }
 
 func TestClient_CreateMessage(t *testing.T) {
-	f, err := os.Open("/Users/nhooyr/Desktop/screenshot.png")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer f.Close()
-
 	params := &ParamsMessageCreate{
 		Content: "boar",
 		File: &ParamsFile{
 			Name:    "screenshot.png",
-			Content: f,
+			Content: bytes.NewReader([]byte("\x89PNG")),
 		},
 		Embed: &ModelEmbed{
 			Description: "heads",
@@ -56,6 +50,9 @@ func TestClient_CreateMessage(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(msg.Attachments) != 1 {
+		t.Fatalf("expected %v but got %v attachments", 1, len(msg.Attachments))
+	}
 	t.Log(msg)
 }
 
@@ -74,6 +71,7 @@ func TestClient_DeleteReaction(t *testing.T) {
 }
 
 func TestClient_GetReactions(t *testing.T) {
+	srv.AddReaction(cID, mID, emoji, uID)
 	users, err := client.Channel(cID).Message(mID).Reactions().Get(ctx, emoji)
 	if err != nil {
 		t.Fatal(err)
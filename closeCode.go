@@ -0,0 +1,102 @@
+package discgo
+
+import (
+	"fmt"
+)
+
+// CloseCode is a Discord gateway close code.
+type CloseCode int
+
+// See https://discordapp.com/developers/docs/topics/opcodes-and-status-codes#gateway-gateway-close-event-codes
+const (
+	CloseCodeUnknownError         CloseCode = 4000
+	CloseCodeUnknownOpcode        CloseCode = 4001
+	CloseCodeDecodeError          CloseCode = 4002
+	CloseCodeNotAuthenticated     CloseCode = 4003
+	CloseCodeAuthenticationFailed CloseCode = 4004
+	CloseCodeAlreadyAuthenticated CloseCode = 4005
+	CloseCodeInvalidSeq           CloseCode = 4007
+	CloseCodeRateLimited          CloseCode = 4008
+	CloseCodeSessionTimeout       CloseCode = 4009
+	CloseCodeInvalidShard         CloseCode = 4010
+	CloseCodeShardingRequired     CloseCode = 4011
+	CloseCodeInvalidAPIVersion    CloseCode = 4012
+	CloseCodeInvalidIntents       CloseCode = 4013
+	CloseCodeDisallowedIntents    CloseCode = 4014
+)
+
+// CloseAction is what the GatewayClient does after the gateway closes the connection.
+type CloseAction int
+
+const (
+	// Reconnect and resume the session.
+	CloseActionResume CloseAction = iota
+	// Reconnect with a new session.
+	CloseActionIdentify
+	// Stop. Reconnecting would fail the same way.
+	CloseActionFatal
+)
+
+func (a CloseAction) String() string {
+	switch a {
+	case CloseActionResume:
+		return "resume"
+	case CloseActionIdentify:
+		return "identify"
+	case CloseActionFatal:
+		return "fatal"
+	}
+	return fmt.Sprintf("CloseAction(%d)", int(a))
+}
+
+// Action classifies the code.
+// Codes that are not Discord's, e.g. a 1006 abnormal closure, are resumable.
+func (code CloseCode) Action() CloseAction {
+	switch code {
+	case CloseCodeNotAuthenticated, CloseCodeInvalidSeq, CloseCodeSessionTimeout:
+		return CloseActionIdentify
+	case CloseCodeAuthenticationFailed, CloseCodeInvalidShard, CloseCodeShardingRequired, CloseCodeInvalidAPIVersion,
+		CloseCodeInvalidIntents, CloseCodeDisallowedIntents:
+		return CloseActionFatal
+	}
+	return CloseActionResume
+}
+
+// GatewayCloseError is returned when the gateway closes the connection with a close frame.
+type GatewayCloseError struct {
+	Code CloseCode
+	Text string
+}
+
+func (err *GatewayCloseError) Error() string {
+	return fmt.Sprintf("gateway closed the connection with code %d (%v): %v", int(err.Code), err.Code.Action(), err.Text)
+}
+
+// VoiceCloseCode is a Discord voice gateway close code.
+type VoiceCloseCode int
+
+// See https://discordapp.com/developers/docs/topics/opcodes-and-status-codes#voice-voice-close-event-codes
+const (
+	VoiceCloseCodeUnknownOpcode         VoiceCloseCode = 4001
+	VoiceCloseCodeDecodeError           VoiceCloseCode = 4002
+	VoiceCloseCodeNotAuthenticated      VoiceCloseCode = 4003
+	VoiceCloseCodeAuthenticationFailed  VoiceCloseCode = 4004
+	VoiceCloseCodeAlreadyAuthenticated  VoiceCloseCode = 4005
+	VoiceCloseCodeSessionNoLongerValid  VoiceCloseCode = 4006
+	VoiceCloseCodeSessionTimeout        VoiceCloseCode = 4009
+	VoiceCloseCodeServerNotFound        VoiceCloseCode = 4011
+	VoiceCloseCodeUnknownProtocol       VoiceCloseCode = 4012
+	VoiceCloseCodeDisconnected          VoiceCloseCode = 4014
+	VoiceCloseCodeVoiceServerCrashed    VoiceCloseCode = 4015
+	VoiceCloseCodeUnknownEncryptionMode VoiceCloseCode = 4016
+)
+
+// VoiceCloseError is returned when the voice server closes the connection with a close frame.
+type VoiceCloseError struct {
+	Code VoiceCloseCode
+	Text string
+}
+
+func (err *VoiceCloseError) Error() string {
+	return fmt.Sprintf("voice server closed the connection with code %d: %v", int(err.Code), err.Text)
+}
@@ -0,0 +1,29 @@
+package discgo
+
+import (
+	"testing"
+)
+
+func TestCloseCode_Action(t *testing.T) {
+	testCases := []struct {
+		code   CloseCode
+		action CloseAction
+	}{
+		{1006, CloseActionResume},
+		{CloseCodeUnknownError, CloseActionResume},
+		{CloseCodeRateLimited, CloseActionResume},
+		{CloseCodeInvalidSeq, CloseActionIdentify},
+		{CloseCodeSessionTimeout, CloseActionIdentify},
+		{CloseCodeAuthenticationFailed, CloseActionFatal},
+		{CloseCodeInvalidShard, CloseActionFatal},
+		{CloseCodeShardingRequired, CloseActionFatal},
+		{CloseCodeInvalidIntents, CloseActionFatal},
+		{CloseCodeDisallowedIntents, CloseActionFatal},
+	}
+	for _, tc := range testCases {
+		action := tc.code.Action()
+		if action != tc.action {
+			t.Fatalf("expected %v but got %v for %v", tc.action, action, int(tc.code))
+		}
+	}
+}
@@ -0,0 +1,607 @@
+package discgotest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nhooyr/discgo/etf"
+)
+
+// Gateway opcodes.
+const (
+	OpDispatch = iota
+	OpHeartbeat
+	OpIdentify
+	OpStatusUpdate
+	OpVoiceStateUpdate
+	OpVoiceServerPing
+	OpResume
+	OpReconnect
+	OpRequestGuildMembers
+	OpInvalidSession
+	OpHello
+	OpHeartbeatACK
+)
+
+// Gateway close codes.
+const (
+	CloseUnknownError         = 4000
+	CloseUnknownOpcode        = 4001
+	CloseDecodeError          = 4002
+	CloseNotAuthenticated     = 4003
+	CloseAuthenticationFailed = 4004
+	CloseAlreadyAuthenticated = 4005
+	CloseInvalidSeq           = 4007
+	CloseRateLimited          = 4008
+	CloseSessionTimeout       = 4009
+	CloseInvalidShard         = 4010
+	CloseShardingRequired     = 4011
+)
+
+var DefaultHeartbeatInterval = 41250 * time.Millisecond
+
+// GatewayPayload is a payload sent or received by the Gateway.
+type GatewayPayload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+	S  int             `json:"s,omitempty"`
+	T  string          `json:"t,omitempty"`
+}
+
+// Gateway is a fake Discord gateway. It sends Hello, answers Identify with Ready and Resume with
+// the missed dispatches followed by Resumed, and acknowledges heartbeats.
+// Payloads are compressed like Discord with zlib-stream or, if identify asks for it, one by one.
+// Like Discord, a client closing the connection normally invalidates its session.
+// Everything else is scripted by the test: dispatches, invalid sessions, reconnects,
+// dropped connections, withheld heartbeat ACKs and close codes.
+//
+// The scripting methods act on the connection that connected last and the session that
+// identified last unless they take a shard.
+type Gateway struct {
+	// Use as the GatewayURL of a discgo.GatewayClient.
+	URL   string
+	Token string
+	// The user in Ready.
+	Me *User
+	// Sent in Hello. Must be set before the first connection.
+	HeartbeatInterval time.Duration
+	// If more than 1, identifies with fewer shards are closed with CloseShardingRequired.
+	// Must be set before the first connection.
+	ShardCount int
+	// If set, voice state updates are answered with a Voice State Update and, unless leaving,
+	// a Voice Server Update with this endpoint. Must be set before the first connection.
+	VoiceEndpoint string
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu            sync.Mutex
+	conn          *gatewayConn
+	session       *gatewaySession
+	sessions      map[string]*gatewaySession
+	nextSessionID int
+	connections   int
+	withholdACKs  bool
+	payloads      []*GatewayPayload
+	// Closed and replaced whenever a payload is received.
+	received chan struct{}
+}
+
+type gatewaySession struct {
+	n     int
+	id    string
+	shard [2]int
+	seq   int
+	// Every dispatch sent in the session so that they can be replayed on resume.
+	dispatches []*GatewayPayload
+	// nil when the session is disconnected.
+	conn *gatewayConn
+}
+
+type gatewayConn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+	session *gatewaySession
+	// Set if the client connected with compress=zlib-stream.
+	zw   *zlib.Writer
+	zbuf bytes.Buffer
+	// Set if the client identified with compress, dispatches are then compressed one by one.
+	compress bool
+	// Set if the client connected with encoding=etf.
+	etf bool
+}
+
+// NewGateway starts a Gateway authorizing the given token.
+// The gateway must be closed with Close.
+func NewGateway(token string) *Gateway {
+	gw := &Gateway{
+		Token: token,
+		Me: &User{
+			ID:            "1",
+			Discriminator: "0001",
+			Username:      "discgotest",
+			Bot:           true,
+		},
+		HeartbeatInterval: DefaultHeartbeatInterval,
+		sessions:          make(map[string]*gatewaySession),
+		received:          make(chan struct{}),
+	}
+	gw.srv = httptest.NewServer(http.HandlerFunc(gw.serveHTTP))
+	gw.URL = "ws" + strings.TrimPrefix(gw.srv.URL, "http")
+	return gw
+}
+
+// Close drops every connection and stops the gateway.
+func (gw *Gateway) Close() {
+	gw.mu.Lock()
+	for _, sess := range gw.sessions {
+		if sess.conn != nil {
+			sess.conn.ws.Close()
+		}
+	}
+	gw.mu.Unlock()
+	gw.Drop()
+	gw.srv.Close()
+}
+
+// Connections returns how many connections have been accepted.
+func (gw *Gateway) Connections() int {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	return gw.connections
+}
+
+// WithholdACKs controls whether heartbeats are acknowledged.
+func (gw *Gateway) WithholdACKs(withhold bool) {
+	gw.mu.Lock()
+	gw.withholdACKs = withhold
+	gw.mu.Unlock()
+}
+
+// Next waits for the next payload received with the given opcode.
+// Payloads received before it are discarded.
+func (gw *Gateway) Next(ctx context.Context, op int) (*GatewayPayload, error) {
+	for {
+		gw.mu.Lock()
+		for i, p := range gw.payloads {
+			if p.Op == op {
+				gw.payloads = gw.payloads[i+1:]
+				gw.mu.Unlock()
+				return p, nil
+			}
+		}
+		gw.payloads = nil
+		received := gw.received
+		gw.mu.Unlock()
+
+		select {
+		case <-received:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+var errNoSession = errors.New("no session has been identified")
+
+// Dispatch sends an event in the current session.
+// If the session is not connected, the event is sent when it resumes.
+func (gw *Gateway) Dispatch(t string, d interface{}) error {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	if gw.session == nil {
+		return errNoSession
+	}
+	return gw.dispatch(gw.session, t, d)
+}
+
+// DispatchShard sends an event in the last session identified with the shard.
+func (gw *Gateway) DispatchShard(shard int, t string, d interface{}) error {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	var sess *gatewaySession
+	for _, s := range gw.sessions {
+		if s.shard[0] == shard && (sess == nil || s.n > sess.n) {
+			sess = s
+		}
+	}
+	if sess == nil {
+		return errNoSession
+	}
+	return gw.dispatch(sess, t, d)
+}
+
+// Sessions returns how many sessions can be resumed.
+func (gw *Gateway) Sessions() int {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	return len(gw.sessions)
+}
+
+func (gw *Gateway) dispatch(sess *gatewaySession, t string, d interface{}) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	sess.seq++
+	p := &GatewayPayload{
+		Op: OpDispatch,
+		D:  b,
+		S:  sess.seq,
+		T:  t,
+	}
+	sess.dispatches = append(sess.dispatches, p)
+	if sess.conn == nil {
+		return nil
+	}
+	return sess.conn.write(p)
+}
+
+func (gw *Gateway) forget(sess *gatewaySession) {
+	if sess == nil {
+		return
+	}
+	delete(gw.sessions, sess.id)
+	if gw.session == sess {
+		gw.session = nil
+	}
+	if sess.conn != nil {
+		sess.conn.session = nil
+		sess.conn = nil
+	}
+}
+
+// InvalidSession sends an Invalid Session on the current connection.
+// If resumable is false, the session is forgotten.
+func (gw *Gateway) InvalidSession(resumable bool) error {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	if gw.conn == nil {
+		return errNoConnection
+	}
+	if !resumable {
+		gw.forget(gw.conn.session)
+	}
+	return gw.conn.writeOp(OpInvalidSession, resumable)
+}
+
+// Reconnect asks the client to reconnect and resume.
+func (gw *Gateway) Reconnect() error {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	if gw.conn == nil {
+		return errNoConnection
+	}
+	return gw.conn.writeOp(OpReconnect, nil)
+}
+
+var errNoConnection = errors.New("no connection")
+
+// Drop closes the current connection without a close frame,
+// as if the network failed.
+func (gw *Gateway) Drop() {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	if c := gw.conn; c != nil {
+		gw.disconnect(c)
+		c.ws.Close()
+	}
+}
+
+func (gw *Gateway) disconnect(c *gatewayConn) {
+	if gw.conn == c {
+		gw.conn = nil
+	}
+	if c.session != nil && c.session.conn == c {
+		c.session.conn = nil
+	}
+}
+
+// CloseWithCode closes the current connection with a close frame.
+// The session is forgotten unless code is CloseUnknownError, like Discord.
+func (gw *Gateway) CloseWithCode(code int, text string) error {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	if gw.conn == nil {
+		return errNoConnection
+	}
+	gw.closeConn(gw.conn, code, text)
+	return nil
+}
+
+func (gw *Gateway) closeConn(c *gatewayConn, code int, text string) {
+	if code != CloseUnknownError {
+		gw.forget(c.session)
+	}
+	gw.disconnect(c)
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	msg := websocket.FormatCloseMessage(code, text)
+	c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	c.ws.Close()
+}
+
+func (c *gatewayConn) write(p *GatewayPayload) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	b, err := c.marshal(p)
+	if err != nil {
+		return err
+	}
+	switch {
+	case c.zw != nil:
+		return c.writeZlibStream(b)
+	case c.compress && p.Op == OpDispatch:
+		return c.writeCompressed(b)
+	case c.etf:
+		return c.ws.WriteMessage(websocket.BinaryMessage, b)
+	}
+	return c.ws.WriteMessage(websocket.TextMessage, b)
+}
+
+func (c *gatewayConn) marshal(p *GatewayPayload) ([]byte, error) {
+	if c.etf {
+		return etf.Marshal(p)
+	}
+	return json.Marshal(p)
+}
+
+func (c *gatewayConn) read(p *GatewayPayload) error {
+	if !c.etf {
+		return c.ws.ReadJSON(p)
+	}
+	_, b, err := c.ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return etf.Unmarshal(b, p)
+}
+
+// writeZlibStream is called with c.writeMu locked.
+// The payload is split across two messages, like Discord does with large payloads.
+func (c *gatewayConn) writeZlibStream(b []byte) error {
+	c.zbuf.Reset()
+	c.zw.Write(b)
+	// Ends the payload with 0x0000FFFF.
+	err := c.zw.Flush()
+	if err != nil {
+		return err
+	}
+	b = c.zbuf.Bytes()
+	err = c.ws.WriteMessage(websocket.BinaryMessage, b[:len(b)/2])
+	if err != nil {
+		return err
+	}
+	return c.ws.WriteMessage(websocket.BinaryMessage, b[len(b)/2:])
+}
+
+// writeCompressed is called with c.writeMu locked.
+func (c *gatewayConn) writeCompressed(b []byte) error {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(b)
+	err := zw.Close()
+	if err != nil {
+		return err
+	}
+	return c.ws.WriteMessage(websocket.BinaryMessage, buf.Bytes())
+}
+
+func (c *gatewayConn) writeOp(op int, d interface{}) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return c.write(&GatewayPayload{Op: op, D: b})
+}
+
+func (gw *Gateway) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := gw.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &gatewayConn{
+		ws:  ws,
+		etf: r.URL.Query().Get("encoding") == "etf",
+	}
+	if r.URL.Query().Get("compress") == "zlib-stream" {
+		c.zw = zlib.NewWriter(&c.zbuf)
+	}
+
+	gw.mu.Lock()
+	gw.connections++
+	gw.conn = c
+	err = c.writeOp(OpHello, map[string]interface{}{
+		"heartbeat_interval": int(gw.HeartbeatInterval / time.Millisecond),
+		"_trace":             []string{"discgotest"},
+	})
+	gw.mu.Unlock()
+	if err != nil {
+		ws.Close()
+		return
+	}
+
+	for {
+		var p GatewayPayload
+		err := c.read(&p)
+		if err != nil {
+			gw.mu.Lock()
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				// Like Discord, closing normally invalidates the session.
+				gw.forget(c.session)
+			}
+			gw.disconnect(c)
+			gw.mu.Unlock()
+			ws.Close()
+			return
+		}
+
+		gw.mu.Lock()
+		gw.payloads = append(gw.payloads, &p)
+		close(gw.received)
+		gw.received = make(chan struct{})
+		gw.onPayload(c, &p)
+		gw.mu.Unlock()
+	}
+}
+
+// onPayload is called with gw.mu locked.
+func (gw *Gateway) onPayload(c *gatewayConn, p *GatewayPayload) {
+	switch p.Op {
+	case OpHeartbeat:
+		if !gw.withholdACKs {
+			c.writeOp(OpHeartbeatACK, nil)
+		}
+	case OpIdentify:
+		var identify struct {
+			Token    string  `json:"token"`
+			Shard    *[2]int `json:"shard"`
+			Compress bool    `json:"compress"`
+		}
+		err := json.Unmarshal(p.D, &identify)
+		if err != nil {
+			gw.closeConn(c, CloseDecodeError, "Error while decoding payload.")
+			return
+		}
+		if identify.Token != gw.Token {
+			gw.closeConn(c, CloseAuthenticationFailed, "Authentication failed.")
+			return
+		}
+		if c.session != nil {
+			gw.closeConn(c, CloseAlreadyAuthenticated, "Already authenticated.")
+			return
+		}
+		shard := [2]int{0, 1}
+		if identify.Shard != nil {
+			shard = *identify.Shard
+		}
+		if shard[1] < 1 || shard[0] < 0 || shard[0] >= shard[1] {
+			gw.closeConn(c, CloseInvalidShard, "Invalid shard.")
+			return
+		}
+		if shard[1] < gw.ShardCount {
+			gw.closeConn(c, CloseShardingRequired, "Sharding required.")
+			return
+		}
+		if identify.Compress && c.zw != nil {
+			gw.closeConn(c, CloseDecodeError, "Cannot use both compress and zlib-stream.")
+			return
+		}
+		c.writeMu.Lock()
+		c.compress = identify.Compress
+		c.writeMu.Unlock()
+		gw.nextSessionID++
+		sess := &gatewaySession{
+			n:     gw.nextSessionID,
+			id:    strconv.Itoa(gw.nextSessionID),
+			shard: shard,
+			conn:  c,
+		}
+		gw.sessions[sess.id] = sess
+		gw.session = sess
+		c.session = sess
+		gw.dispatch(sess, "READY", map[string]interface{}{
+			"v":                6,
+			"user":             gw.Me,
+			"private_channels": []struct{}{},
+			"guilds":           []struct{}{},
+			"session_id":       sess.id,
+			"_trace":           []string{"discgotest"},
+		})
+	case OpResume:
+		var resume struct {
+			Token     string `json:"token"`
+			SessionID string `json:"session_id"`
+			Seq       int    `json:"seq"`
+		}
+		err := json.Unmarshal(p.D, &resume)
+		if err != nil {
+			gw.closeConn(c, CloseDecodeError, "Error while decoding payload.")
+			return
+		}
+		if resume.Token != gw.Token {
+			gw.closeConn(c, CloseAuthenticationFailed, "Authentication failed.")
+			return
+		}
+		sess, ok := gw.sessions[resume.SessionID]
+		if !ok {
+			c.writeOp(OpInvalidSession, false)
+			return
+		}
+		if resume.Seq > sess.seq {
+			gw.closeConn(c, CloseInvalidSeq, "Invalid seq.")
+			return
+		}
+		if sess.conn != nil {
+			// Resumed on a new connection before the old one was closed.
+			sess.conn.session = nil
+		}
+		c.session = sess
+		sess.conn = c
+		for _, d := range sess.dispatches {
+			if d.S > resume.Seq {
+				c.write(d)
+			}
+		}
+		gw.dispatch(sess, "RESUMED", map[string]interface{}{
+			"_trace": []string{"discgotest"},
+		})
+	case OpVoiceStateUpdate:
+		if c.session == nil {
+			gw.closeConn(c, CloseNotAuthenticated, "Not authenticated.")
+			return
+		}
+		if gw.VoiceEndpoint != "" {
+			gw.answerVoiceStateUpdate(c, p)
+		}
+	case OpStatusUpdate, OpVoiceServerPing, OpRequestGuildMembers:
+		if c.session == nil {
+			gw.closeConn(c, CloseNotAuthenticated, "Not authenticated.")
+		}
+	default:
+		gw.closeConn(c, CloseUnknownOpcode, "Unknown opcode.")
+	}
+}
+
+// VoiceToken is the token sent in Voice Server Updates.
+const VoiceToken = "voicetoken"
+
+func (gw *Gateway) answerVoiceStateUpdate(c *gatewayConn, p *GatewayPayload) {
+	var d struct {
+		GuildID   string  `json:"guild_id"`
+		ChannelID *string `json:"channel_id"`
+		SelfMute  bool    `json:"self_mute"`
+		SelfDeaf  bool    `json:"self_deaf"`
+	}
+	err := json.Unmarshal(p.D, &d)
+	if err != nil {
+		gw.closeConn(c, CloseDecodeError, "Error while decoding payload.")
+		return
+	}
+	gw.dispatch(c.session, "VOICE_STATE_UPDATE", map[string]interface{}{
+		"guild_id":   d.GuildID,
+		"channel_id": d.ChannelID,
+		"user_id":    gw.Me.ID,
+		"session_id": c.session.id,
+		"self_mute":  d.SelfMute,
+		"self_deaf":  d.SelfDeaf,
+	})
+	if d.ChannelID != nil {
+		gw.dispatch(c.session, "VOICE_SERVER_UPDATE", map[string]interface{}{
+			"token":    VoiceToken,
+			"guild_id": d.GuildID,
+			"endpoint": gw.VoiceEndpoint,
+		})
+	}
+}
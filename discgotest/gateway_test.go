@@ -0,0 +1,39 @@
+package discgotest
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestGateway_AuthenticationFailed(t *testing.T) {
+	gw := NewGateway("token")
+	defer gw.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial(gw.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	var hello GatewayPayload
+	err = ws.ReadJSON(&hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hello.Op != OpHello {
+		t.Fatalf("expected %v but got %v", OpHello, hello.Op)
+	}
+
+	err = ws.WriteJSON(map[string]interface{}{
+		"op": OpIdentify,
+		"d":  map[string]string{"token": "wrong"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ws.ReadMessage()
+	if !websocket.IsCloseError(err, CloseAuthenticationFailed) {
+		t.Fatalf("expected close %v but got %v", CloseAuthenticationFailed, err)
+	}
+}
@@ -0,0 +1,186 @@
+package discgotest
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The models mirror the JSON Discord sends. They are separate from the discgo models
+// so that discgo's own tests can use this package.
+
+type User struct {
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Discriminator string `json:"discriminator"`
+	Avatar        string `json:"avatar,omitempty"`
+	Bot           bool   `json:"bot,omitempty"`
+}
+
+type Guild struct {
+	ID                          string    `json:"id"`
+	Name                        string    `json:"name"`
+	Icon                        string    `json:"icon,omitempty"`
+	Splash                      string    `json:"splash,omitempty"`
+	OwnerID                     string    `json:"owner_id"`
+	Region                      string    `json:"region"`
+	AFKChannelID                string    `json:"afk_channel_id,omitempty"`
+	AFKTimeout                  int       `json:"afk_timeout"`
+	EmbedEnabled                bool      `json:"embed_enabled"`
+	EmbedChannelID              string    `json:"embed_channel_id,omitempty"`
+	VerificationLevel           int       `json:"verification_level"`
+	DefaultMessageNotifications int       `json:"default_message_notifications"`
+	Roles                       []*Role   `json:"roles"`
+	Emojis                      []*Emoji  `json:"emojis"`
+	Features                    []string  `json:"features"`
+	MFALevel                    int       `json:"mfa_level"`
+	JoinedAt                    time.Time `json:"joined_at"`
+}
+
+type Role struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Color       int    `json:"color"`
+	Hoist       bool   `json:"hoist"`
+	Position    int    `json:"position"`
+	Permissions int    `json:"permissions"`
+	Managed     bool   `json:"managed"`
+	Mentionable bool   `json:"mentionable"`
+}
+
+type Emoji struct {
+	ID            string   `json:"id,omitempty"`
+	Name          string   `json:"name"`
+	Roles         []string `json:"roles,omitempty"`
+	RequireColons bool     `json:"require_colons,omitempty"`
+	Managed       bool     `json:"managed,omitempty"`
+}
+
+type Member struct {
+	User     *User     `json:"user"`
+	Nick     *string   `json:"nick"`
+	Roles    []string  `json:"roles"`
+	JoinedAt time.Time `json:"joined_at"`
+	Deaf     bool      `json:"deaf"`
+	Mute     bool      `json:"mute"`
+}
+
+const (
+	ChannelTypeGuildText = iota
+	ChannelTypeDM
+	ChannelTypeGuildVoice
+	ChannelTypeGroupDM
+	ChannelTypeGuildCategory
+)
+
+type Channel struct {
+	ID                   string                 `json:"id"`
+	Type                 int                    `json:"type"`
+	GuildID              string                 `json:"guild_id,omitempty"`
+	Position             int                    `json:"position"`
+	PermissionOverwrites []*PermissionOverwrite `json:"permission_overwrites,omitempty"`
+	Name                 string                 `json:"name,omitempty"`
+	Topic                string                 `json:"topic,omitempty"`
+	LastMessageID        string                 `json:"last_message_id,omitempty"`
+	Bitrate              int                    `json:"bitrate,omitempty"`
+	UserLimit            int                    `json:"user_limit,omitempty"`
+	Recipients           []*User                `json:"recipients,omitempty"`
+}
+
+type PermissionOverwrite struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Allow int    `json:"allow"`
+	Deny  int    `json:"deny"`
+}
+
+type Message struct {
+	ID              string            `json:"id"`
+	ChannelID       string            `json:"channel_id"`
+	Author          *User             `json:"author"`
+	Content         string            `json:"content"`
+	Timestamp       time.Time         `json:"timestamp"`
+	EditedTimestamp *time.Time        `json:"edited_timestamp"`
+	TTS             bool              `json:"tts"`
+	MentionEveryone bool              `json:"mention_everyone"`
+	Mentions        []*User           `json:"mentions"`
+	MentionRoles    []string          `json:"mention_roles"`
+	Attachments     []*Attachment     `json:"attachments"`
+	Embeds          []json.RawMessage `json:"embeds"`
+	Reactions       []*Reaction       `json:"reactions,omitempty"`
+	Nonce           *string           `json:"nonce"`
+	Pinned          bool              `json:"pinned"`
+	Type            int               `json:"type"`
+}
+
+type Attachment struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	Size     int    `json:"size"`
+	URL      string `json:"url"`
+	ProxyURL string `json:"proxy_url"`
+}
+
+type Reaction struct {
+	Count int           `json:"count"`
+	Me    bool          `json:"me"`
+	Emoji ReactionEmoji `json:"emoji"`
+
+	userIDs []string
+}
+
+type ReactionEmoji struct {
+	ID   *string `json:"id"`
+	Name string  `json:"name"`
+}
+
+type Invite struct {
+	Code      string         `json:"code"`
+	Guild     *InviteGuild   `json:"guild"`
+	Channel   *InviteChannel `json:"channel"`
+	Inviter   *User          `json:"inviter,omitempty"`
+	Uses      int            `json:"uses"`
+	MaxUses   int            `json:"max_uses"`
+	MaxAge    int            `json:"max_age"`
+	Temporary bool           `json:"temporary"`
+	CreatedAt time.Time      `json:"created_at"`
+	Revoked   bool           `json:"revoked"`
+}
+
+type InviteGuild struct {
+	ID     string  `json:"id"`
+	Name   string  `json:"name"`
+	Splash *string `json:"splash"`
+	Icon   *string `json:"icon"`
+}
+
+type InviteChannel struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type int    `json:"type"`
+}
+
+type VoiceRegion struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	SampleHostname string `json:"sample_hostname"`
+	SamplePort     int    `json:"sample_port"`
+	VIP            bool   `json:"vip"`
+	Optimal        bool   `json:"optimal"`
+	Deprecated     bool   `json:"deprecated"`
+	Custom         bool   `json:"custom"`
+}
+
+type Integration struct {
+	ID                string `json:"id"`
+	Name              string `json:"name"`
+	Type              string `json:"type"`
+	Enabled           bool   `json:"enabled"`
+	Syncing           bool   `json:"syncing"`
+	ExpireBehaviour   int    `json:"expire_behaviour"`
+	ExpireGracePeriod int    `json:"expire_grace_period"`
+}
+
+type GuildEmbed struct {
+	Enabled   bool   `json:"enabled"`
+	ChannelID string `json:"channel_id,omitempty"`
+}
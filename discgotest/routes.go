@@ -0,0 +1,1604 @@
+package discgotest
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var routes []route
+
+func handle(method, pattern string, h handler) {
+	routes = append(routes, route{
+		method:   method,
+		elements: strings.Split(pattern, "/"),
+		handler:  h,
+	})
+}
+
+func init() {
+	handle("GET", "gateway", getGateway)
+	handle("GET", "gateway/bot", getGatewayBot)
+	handle("GET", "voice/regions", getVoiceRegions)
+
+	handle("GET", "channels/{channel}", getChannel)
+	handle("PATCH", "channels/{channel}", modifyChannel)
+	handle("DELETE", "channels/{channel}", deleteChannel)
+	handle("GET", "channels/{channel}/messages", getMessages)
+	handle("POST", "channels/{channel}/messages", createMessage)
+	handle("POST", "channels/{channel}/messages/bulk-delete", bulkDeleteMessages)
+	handle("GET", "channels/{channel}/messages/{message}", getMessage)
+	handle("PATCH", "channels/{channel}/messages/{message}", editMessage)
+	handle("DELETE", "channels/{channel}/messages/{message}", deleteMessage)
+	handle("DELETE", "channels/{channel}/messages/{message}/reactions", deleteReactions)
+	handle("GET", "channels/{channel}/messages/{message}/reactions/{emoji}", getReactions)
+	handle("PUT", "channels/{channel}/messages/{message}/reactions/{emoji}/@me", createReaction)
+	handle("DELETE", "channels/{channel}/messages/{message}/reactions/{emoji}/{user}", deleteReaction)
+	handle("PUT", "channels/{channel}/permissions/{overwrite}", editPermissionOverwrite)
+	handle("DELETE", "channels/{channel}/permissions/{overwrite}", deletePermissionOverwrite)
+	handle("GET", "channels/{channel}/invites", getChannelInvites)
+	handle("POST", "channels/{channel}/invites", createInvite)
+	handle("POST", "channels/{channel}/typing", triggerTyping)
+	handle("GET", "channels/{channel}/pins", getPins)
+	handle("PUT", "channels/{channel}/pins/{message}", addPin)
+	handle("DELETE", "channels/{channel}/pins/{message}", deletePin)
+	handle("PUT", "channels/{channel}/recipients/{user}", addRecipient)
+	handle("DELETE", "channels/{channel}/recipients/{user}", deleteRecipient)
+
+	handle("POST", "guilds", createGuild)
+	handle("GET", "guilds/{guild}", getGuild)
+	handle("PATCH", "guilds/{guild}", modifyGuild)
+	handle("DELETE", "guilds/{guild}", deleteGuild)
+	handle("GET", "guilds/{guild}/channels", getGuildChannels)
+	handle("POST", "guilds/{guild}/channels", createGuildChannel)
+	handle("PATCH", "guilds/{guild}/channels", modifyGuildChannelPositions)
+	handle("PATCH", "guilds/{guild}/members/@me/nick", modifyMyNick)
+	handle("GET", "guilds/{guild}/members", getMembers)
+	handle("GET", "guilds/{guild}/members/{user}", getMember)
+	handle("PUT", "guilds/{guild}/members/{user}", addMember)
+	handle("PATCH", "guilds/{guild}/members/{user}", modifyMember)
+	handle("DELETE", "guilds/{guild}/members/{user}", removeMember)
+	handle("PUT", "guilds/{guild}/members/{user}/roles/{role}", addMemberRole)
+	handle("DELETE", "guilds/{guild}/members/{user}/roles/{role}", removeMemberRole)
+	handle("GET", "guilds/{guild}/bans", getBans)
+	handle("PUT", "guilds/{guild}/bans/{user}", createBan)
+	handle("DELETE", "guilds/{guild}/bans/{user}", removeBan)
+	handle("GET", "guilds/{guild}/roles", getRoles)
+	handle("POST", "guilds/{guild}/roles", createRole)
+	handle("PATCH", "guilds/{guild}/roles", modifyRolePositions)
+	handle("PATCH", "guilds/{guild}/roles/{role}", modifyRole)
+	handle("DELETE", "guilds/{guild}/roles/{role}", deleteRole)
+	handle("GET", "guilds/{guild}/prune", prune)
+	handle("POST", "guilds/{guild}/prune", prune)
+	handle("GET", "guilds/{guild}/regions", getVoiceRegions)
+	handle("GET", "guilds/{guild}/invites", getGuildInvites)
+	handle("GET", "guilds/{guild}/integrations", getIntegrations)
+	handle("POST", "guilds/{guild}/integrations", createIntegration)
+	handle("PATCH", "guilds/{guild}/integrations/{integration}", modifyIntegration)
+	handle("DELETE", "guilds/{guild}/integrations/{integration}", deleteIntegration)
+	handle("POST", "guilds/{guild}/integrations/{integration}/sync", syncIntegration)
+	handle("GET", "guilds/{guild}/embed", getGuildEmbed)
+	handle("PATCH", "guilds/{guild}/embed", modifyGuildEmbed)
+
+	handle("GET", "users/@me", getMe)
+	handle("PATCH", "users/@me", modifyMe)
+	handle("GET", "users/@me/guilds", getMyGuilds)
+	handle("DELETE", "users/@me/guilds/{guild}", leaveGuild)
+	handle("GET", "users/@me/channels", getDMChannels)
+	handle("POST", "users/@me/channels", createDMChannel)
+	handle("GET", "users/@me/connections", getConnections)
+	handle("GET", "users/{user}", getUser)
+
+	handle("GET", "invites/{invite}", getInvite)
+	handle("DELETE", "invites/{invite}", deleteInvite)
+	handle("POST", "invites/{invite}", acceptInvite)
+}
+
+func decode(r *request, v interface{}) error {
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+func idLess(id1, id2 string) bool {
+	n1, _ := strconv.ParseUint(id1, 10, 64)
+	n2, _ := strconv.ParseUint(id2, 10, 64)
+	return n1 < n2
+}
+
+func (s *Server) channel(cID string) (*Channel, error) {
+	ch, ok := s.channels[cID]
+	if !ok {
+		return nil, errUnknownChannel
+	}
+	return ch, nil
+}
+
+func (s *Server) guild(gID string) (*guild, error) {
+	g, ok := s.guilds[gID]
+	if !ok {
+		return nil, errUnknownGuild
+	}
+	return g, nil
+}
+
+func (s *Server) message(cID, mID string) *Message {
+	for _, m := range s.messages[cID] {
+		if m.ID == mID {
+			return m
+		}
+	}
+	return nil
+}
+
+func (s *Server) channelMessage(r *request) (*Message, error) {
+	_, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	m := s.message(r.params["channel"], r.params["message"])
+	if m == nil {
+		return nil, errUnknownMessage
+	}
+	return m, nil
+}
+
+func (s *Server) deleteMessages(cID string, ids map[string]bool) {
+	messages := s.messages[cID][:0]
+	for _, m := range s.messages[cID] {
+		if !ids[m.ID] {
+			messages = append(messages, m)
+		}
+	}
+	s.messages[cID] = messages
+}
+
+func (s *Server) guildMember(r *request) (*guild, *Member, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, nil, err
+	}
+	m, ok := g.members[r.params["user"]]
+	if !ok {
+		return nil, nil, errUnknownMember
+	}
+	return g, m, nil
+}
+
+func getGateway(s *Server, r *request) (interface{}, error) {
+	return map[string]string{"url": s.GatewayURL}, nil
+}
+
+func getGatewayBot(s *Server, r *request) (interface{}, error) {
+	return map[string]interface{}{"url": s.GatewayURL, "shards": s.Shards}, nil
+}
+
+func getVoiceRegions(s *Server, r *request) (interface{}, error) {
+	if gID, ok := r.params["guild"]; ok {
+		_, err := s.guild(gID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.voiceRegions, nil
+}
+
+func getChannel(s *Server, r *request) (interface{}, error) {
+	return s.channel(r.params["channel"])
+}
+
+func modifyChannel(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	var params struct {
+		Name      *string `json:"name"`
+		Position  *int    `json:"position"`
+		Topic     *string `json:"topic"`
+		Bitrate   *int    `json:"bitrate"`
+		UserLimit *int    `json:"user_limit"`
+	}
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Name != nil {
+		ch.Name = *params.Name
+	}
+	if params.Position != nil {
+		ch.Position = *params.Position
+	}
+	if params.Topic != nil {
+		ch.Topic = *params.Topic
+	}
+	if params.Bitrate != nil {
+		ch.Bitrate = *params.Bitrate
+	}
+	if params.UserLimit != nil {
+		ch.UserLimit = *params.UserLimit
+	}
+	return ch, nil
+}
+
+func deleteChannel(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	delete(s.channels, ch.ID)
+	delete(s.messages, ch.ID)
+	return ch, nil
+}
+
+func getMessages(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	q := r.URL.Query()
+	limit := 50
+	if q.Get("limit") != "" {
+		limit, err = strconv.Atoi(q.Get("limit"))
+		if err != nil || limit < 1 || limit > 100 {
+			return nil, errBadRequest(errors.New("limit must be between 1 and 100"))
+		}
+	}
+
+	// Newest first.
+	var messages []*Message
+	for _, m := range s.messages[ch.ID] {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return idLess(messages[j].ID, messages[i].ID)
+	})
+
+	var filtered []*Message
+	switch {
+	case q.Get("before") != "":
+		for _, m := range messages {
+			if idLess(m.ID, q.Get("before")) && len(filtered) < limit {
+				filtered = append(filtered, m)
+			}
+		}
+	case q.Get("after") != "":
+		for i := len(messages) - 1; i >= 0 && len(filtered) < limit; i-- {
+			if idLess(q.Get("after"), messages[i].ID) {
+				filtered = append([]*Message{messages[i]}, filtered...)
+			}
+		}
+	case q.Get("around") != "":
+		around := q.Get("around")
+		var before, after []*Message
+		for _, m := range messages {
+			if idLess(m.ID, around) || m.ID == around {
+				before = append(before, m)
+			} else {
+				after = append(after, m)
+			}
+		}
+		n := limit / 2
+		if len(after) > n {
+			after = after[len(after)-n:]
+		}
+		if len(before) > limit-len(after) {
+			before = before[:limit-len(after)]
+		}
+		filtered = append(after, before...)
+	default:
+		filtered = messages
+		if len(filtered) > limit {
+			filtered = filtered[:limit]
+		}
+	}
+	if filtered == nil {
+		filtered = []*Message{}
+	}
+	return filtered, nil
+}
+
+type messageParams struct {
+	Content string          `json:"content"`
+	Nonce   *string         `json:"nonce"`
+	TTS     bool            `json:"tts"`
+	Embed   json.RawMessage `json:"embed"`
+}
+
+func createMessage(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	if ch.Type == ChannelTypeGuildVoice {
+		return nil, &apiError{status: http.StatusBadRequest, Code: 50008, Message: "Cannot send messages in a voice channel"}
+	}
+
+	var params messageParams
+	var attachments []*Attachment
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err = r.ParseMultipartForm(8 << 20)
+		if err != nil {
+			return nil, err
+		}
+		if pj := r.FormValue("payload_json"); pj != "" {
+			err = json.Unmarshal([]byte(pj), &params)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, fhs := range r.MultipartForm.File {
+			for _, fh := range fhs {
+				id := s.newID()
+				url := "https://cdn.discordapp.com/attachments/" + ch.ID + "/" + id + "/" + fh.Filename
+				attachments = append(attachments, &Attachment{
+					ID:       id,
+					Filename: fh.Filename,
+					Size:     int(fh.Size),
+					URL:      url,
+					ProxyURL: url,
+				})
+			}
+		}
+	} else {
+		err = decode(r, &params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hasEmbed := len(params.Embed) > 0 && string(params.Embed) != "null"
+	if params.Content == "" && !hasEmbed && len(attachments) == 0 {
+		return nil, &apiError{status: http.StatusBadRequest, Code: 50006, Message: "Cannot send an empty message"}
+	}
+	if len(params.Content) > 2000 {
+		return nil, &apiError{status: http.StatusBadRequest, Code: 50035, Message: "Invalid Form Body"}
+	}
+
+	m := &Message{
+		ChannelID:   ch.ID,
+		Content:     params.Content,
+		TTS:         params.TTS,
+		Nonce:       params.Nonce,
+		Attachments: attachments,
+	}
+	if hasEmbed {
+		m.Embeds = []json.RawMessage{params.Embed}
+	}
+	return s.addMessage(m), nil
+}
+
+func bulkDeleteMessages(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	var params struct {
+		Messages []string `json:"messages"`
+	}
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.Messages) < 2 || len(params.Messages) > 100 {
+		return nil, &apiError{status: http.StatusBadRequest, Code: 50016, Message: "You must provide at least 2 and fewer than 100 messages to delete."}
+	}
+	ids := make(map[string]bool)
+	for _, id := range params.Messages {
+		ids[id] = true
+	}
+	s.deleteMessages(ch.ID, ids)
+	return nil, nil
+}
+
+func getMessage(s *Server, r *request) (interface{}, error) {
+	m, err := s.channelMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.withMe(m), nil
+}
+
+// withMe returns a copy of m with Reaction.Me set for the bot.
+func (s *Server) withMe(m *Message) *Message {
+	m2 := *m
+	m2.Reactions = nil
+	for _, re := range m.Reactions {
+		re2 := *re
+		for _, uID := range re.userIDs {
+			if uID == s.Me.ID {
+				re2.Me = true
+			}
+		}
+		m2.Reactions = append(m2.Reactions, &re2)
+	}
+	return &m2
+}
+
+func editMessage(s *Server, r *request) (interface{}, error) {
+	m, err := s.channelMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	if m.Author.ID != s.Me.ID {
+		return nil, &apiError{status: http.StatusForbidden, Code: 50005, Message: "Cannot edit a message authored by another user"}
+	}
+	var params messageParams
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Content != "" {
+		m.Content = params.Content
+	}
+	if len(params.Embed) > 0 && string(params.Embed) != "null" {
+		m.Embeds = []json.RawMessage{params.Embed}
+	}
+	now := time.Now()
+	m.EditedTimestamp = &now
+	return s.withMe(m), nil
+}
+
+func deleteMessage(s *Server, r *request) (interface{}, error) {
+	m, err := s.channelMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	s.deleteMessages(m.ChannelID, map[string]bool{m.ID: true})
+	return nil, nil
+}
+
+func deleteReactions(s *Server, r *request) (interface{}, error) {
+	m, err := s.channelMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	m.Reactions = nil
+	return nil, nil
+}
+
+func findReaction(m *Message, emoji string) (int, *Reaction) {
+	for i, re := range m.Reactions {
+		name := re.Emoji.Name
+		if re.Emoji.ID != nil {
+			name += ":" + *re.Emoji.ID
+		}
+		if name == emoji {
+			return i, re
+		}
+	}
+	return -1, nil
+}
+
+func addReaction(m *Message, emoji, uID string) {
+	_, re := findReaction(m, emoji)
+	if re == nil {
+		re = &Reaction{}
+		parts := strings.SplitN(emoji, ":", 2)
+		re.Emoji.Name = parts[0]
+		if len(parts) == 2 {
+			re.Emoji.ID = &parts[1]
+		}
+		m.Reactions = append(m.Reactions, re)
+	}
+	for _, id := range re.userIDs {
+		if id == uID {
+			return
+		}
+	}
+	re.userIDs = append(re.userIDs, uID)
+	re.Count++
+}
+
+func getReactions(s *Server, r *request) (interface{}, error) {
+	m, err := s.channelMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	_, re := findReaction(m, r.params["emoji"])
+	if re == nil {
+		return nil, errUnknownEmoji
+	}
+	users := []*User{}
+	for _, uID := range re.userIDs {
+		if u, ok := s.users[uID]; ok {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func createReaction(s *Server, r *request) (interface{}, error) {
+	m, err := s.channelMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, re := findReaction(m, r.params["emoji"]); re == nil && len(m.Reactions) >= 20 {
+		return nil, &apiError{status: http.StatusBadRequest, Code: 30010, Message: "Maximum number of reactions reached (20)"}
+	}
+	addReaction(m, r.params["emoji"], s.Me.ID)
+	return nil, nil
+}
+
+func deleteReaction(s *Server, r *request) (interface{}, error) {
+	m, err := s.channelMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	i, re := findReaction(m, r.params["emoji"])
+	if re == nil {
+		return nil, errUnknownEmoji
+	}
+	uID := r.params["user"]
+	if uID == "@me" {
+		uID = s.Me.ID
+	}
+	for j, id := range re.userIDs {
+		if id == uID {
+			re.userIDs = append(re.userIDs[:j], re.userIDs[j+1:]...)
+			re.Count--
+			break
+		}
+	}
+	if re.Count == 0 {
+		m.Reactions = append(m.Reactions[:i], m.Reactions[i+1:]...)
+	}
+	return nil, nil
+}
+
+func editPermissionOverwrite(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	var po PermissionOverwrite
+	err = decode(r, &po)
+	if err != nil {
+		return nil, err
+	}
+	po.ID = r.params["overwrite"]
+	for i, po2 := range ch.PermissionOverwrites {
+		if po2.ID == po.ID {
+			ch.PermissionOverwrites[i] = &po
+			return nil, nil
+		}
+	}
+	ch.PermissionOverwrites = append(ch.PermissionOverwrites, &po)
+	return nil, nil
+}
+
+func deletePermissionOverwrite(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	for i, po := range ch.PermissionOverwrites {
+		if po.ID == r.params["overwrite"] {
+			ch.PermissionOverwrites = append(ch.PermissionOverwrites[:i], ch.PermissionOverwrites[i+1:]...)
+			return nil, nil
+		}
+	}
+	return nil, errUnknownOverwrite
+}
+
+func (s *Server) invitesWhere(f func(inv *Invite) bool) []*Invite {
+	invites := []*Invite{}
+	for _, inv := range s.invites {
+		if f(inv) {
+			invites = append(invites, inv)
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].CreatedAt.Before(invites[j].CreatedAt)
+	})
+	return invites
+}
+
+func getChannelInvites(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	return s.invitesWhere(func(inv *Invite) bool {
+		return inv.Channel != nil && inv.Channel.ID == ch.ID
+	}), nil
+}
+
+func createInvite(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	params := struct {
+		MaxAge    *int `json:"max_age"`
+		MaxUses   *int `json:"max_uses"`
+		Temporary bool `json:"temporary"`
+	}{}
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	inv := &Invite{
+		Code:      s.newInviteCode(),
+		Channel:   &InviteChannel{ID: ch.ID, Name: ch.Name, Type: ch.Type},
+		Inviter:   s.Me,
+		MaxAge:    86400,
+		Temporary: params.Temporary,
+		CreatedAt: time.Now(),
+	}
+	if params.MaxAge != nil {
+		inv.MaxAge = *params.MaxAge
+	}
+	if params.MaxUses != nil {
+		inv.MaxUses = *params.MaxUses
+	}
+	if g, ok := s.guilds[ch.GuildID]; ok {
+		inv.Guild = &InviteGuild{ID: g.ID, Name: g.Name}
+	}
+	s.invites[inv.Code] = inv
+	return inv, nil
+}
+
+func (s *Server) newInviteCode() string {
+	id, _ := strconv.ParseUint(s.newID(), 10, 64)
+	return strconv.FormatUint(id, 36)
+}
+
+func triggerTyping(s *Server, r *request) (interface{}, error) {
+	_, err := s.channel(r.params["channel"])
+	return nil, err
+}
+
+func getPins(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	pins := []*Message{}
+	for _, m := range s.messages[ch.ID] {
+		if m.Pinned {
+			pins = append(pins, s.withMe(m))
+		}
+	}
+	return pins, nil
+}
+
+func addPin(s *Server, r *request) (interface{}, error) {
+	m, err := s.channelMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	var pinned int
+	for _, m := range s.messages[m.ChannelID] {
+		if m.Pinned {
+			pinned++
+		}
+	}
+	if pinned >= 50 {
+		return nil, &apiError{status: http.StatusBadRequest, Code: 30003, Message: "Maximum number of pins reached (50)"}
+	}
+	m.Pinned = true
+	return nil, nil
+}
+
+func deletePin(s *Server, r *request) (interface{}, error) {
+	m, err := s.channelMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	m.Pinned = false
+	return nil, nil
+}
+
+func addRecipient(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	u, ok := s.users[r.params["user"]]
+	if !ok {
+		return nil, errUnknownUser
+	}
+	for _, u2 := range ch.Recipients {
+		if u2.ID == u.ID {
+			return nil, nil
+		}
+	}
+	ch.Recipients = append(ch.Recipients, u)
+	return nil, nil
+}
+
+func deleteRecipient(s *Server, r *request) (interface{}, error) {
+	ch, err := s.channel(r.params["channel"])
+	if err != nil {
+		return nil, err
+	}
+	for i, u := range ch.Recipients {
+		if u.ID == r.params["user"] {
+			ch.Recipients = append(ch.Recipients[:i], ch.Recipients[i+1:]...)
+			return nil, nil
+		}
+	}
+	return nil, errUnknownUser
+}
+
+type guildParams struct {
+	Name                        *string `json:"name"`
+	Region                      *string `json:"region"`
+	Icon                        *string `json:"icon"`
+	VerificationLevel           *int    `json:"verification_level"`
+	DefaultMessageNotifications *int    `json:"default_message_notifications"`
+	AFKChannelID                *string `json:"afk_channel_id"`
+	AFKTimeout                  *int    `json:"afk_timeout"`
+	OwnerID                     *string `json:"owner_id"`
+	Splash                      *string `json:"splash"`
+}
+
+func (params *guildParams) apply(g *Guild) {
+	if params.Name != nil {
+		g.Name = *params.Name
+	}
+	if params.Region != nil {
+		g.Region = *params.Region
+	}
+	if params.Icon != nil {
+		g.Icon = *params.Icon
+	}
+	if params.VerificationLevel != nil {
+		g.VerificationLevel = *params.VerificationLevel
+	}
+	if params.DefaultMessageNotifications != nil {
+		g.DefaultMessageNotifications = *params.DefaultMessageNotifications
+	}
+	if params.AFKChannelID != nil {
+		g.AFKChannelID = *params.AFKChannelID
+	}
+	if params.AFKTimeout != nil {
+		g.AFKTimeout = *params.AFKTimeout
+	}
+	if params.OwnerID != nil {
+		g.OwnerID = *params.OwnerID
+	}
+	if params.Splash != nil {
+		g.Splash = *params.Splash
+	}
+}
+
+func validGuildName(name string) error {
+	if len(name) < 2 || len(name) > 100 {
+		return &apiError{status: http.StatusBadRequest, Code: 50035, Message: "Invalid Form Body"}
+	}
+	return nil
+}
+
+func createGuild(s *Server, r *request) (interface{}, error) {
+	var params guildParams
+	err := decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Name == nil {
+		return nil, &apiError{status: http.StatusBadRequest, Code: 50035, Message: "Invalid Form Body"}
+	}
+	err = validGuildName(*params.Name)
+	if err != nil {
+		return nil, err
+	}
+	g := &Guild{Region: "us-east"}
+	params.apply(g)
+	s.addGuild(g)
+	s.channels[g.ID] = &Channel{ID: g.ID, GuildID: g.ID, Name: "general"}
+	return g, nil
+}
+
+func getGuild(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	return g.Guild, nil
+}
+
+func modifyGuild(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	var params guildParams
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Name != nil {
+		err = validGuildName(*params.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	params.apply(g.Guild)
+	return g.Guild, nil
+}
+
+func deleteGuild(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	if g.OwnerID != s.Me.ID {
+		return nil, errMissingPermissions
+	}
+	delete(s.guilds, g.ID)
+	for id, ch := range s.channels {
+		if ch.GuildID == g.ID {
+			delete(s.channels, id)
+			delete(s.messages, id)
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) guildChannels(gID string) []*Channel {
+	channels := []*Channel{}
+	for _, ch := range s.channels {
+		if ch.GuildID == gID {
+			channels = append(channels, ch)
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].Position != channels[j].Position {
+			return channels[i].Position < channels[j].Position
+		}
+		return idLess(channels[i].ID, channels[j].ID)
+	})
+	return channels
+}
+
+func getGuildChannels(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	return s.guildChannels(g.ID), nil
+}
+
+func createGuildChannel(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	var params struct {
+		Name                 string                 `json:"name"`
+		Type                 json.RawMessage        `json:"type"`
+		Bitrate              int                    `json:"bitrate"`
+		UserLimit            int                    `json:"user_limit"`
+		PermissionOverwrites []*PermissionOverwrite `json:"permission_overwrites"`
+	}
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.Name) < 2 || len(params.Name) > 100 {
+		return nil, &apiError{status: http.StatusBadRequest, Code: 50035, Message: "Invalid Form Body"}
+	}
+	ch := &Channel{
+		ID:                   s.newID(),
+		GuildID:              g.ID,
+		Name:                 params.Name,
+		Bitrate:              params.Bitrate,
+		UserLimit:            params.UserLimit,
+		PermissionOverwrites: params.PermissionOverwrites,
+		Position:             len(s.guildChannels(g.ID)),
+	}
+	// The type used to be a string.
+	switch strings.Trim(string(params.Type), `"`) {
+	case "voice", strconv.Itoa(ChannelTypeGuildVoice):
+		ch.Type = ChannelTypeGuildVoice
+		if ch.Bitrate == 0 {
+			ch.Bitrate = 64000
+		}
+	case strconv.Itoa(ChannelTypeGuildCategory):
+		ch.Type = ChannelTypeGuildCategory
+	}
+	s.channels[ch.ID] = ch
+	return ch, nil
+}
+
+func modifyGuildChannelPositions(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	var params []struct {
+		ID       string `json:"id"`
+		Position int    `json:"position"`
+	}
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range params {
+		ch, ok := s.channels[p.ID]
+		if !ok || ch.GuildID != g.ID {
+			return nil, errUnknownChannel
+		}
+		ch.Position = p.Position
+	}
+	return nil, nil
+}
+
+func modifyMyNick(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	var params struct {
+		Nick string `json:"nick"`
+	}
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	m := g.members[s.Me.ID]
+	m.Nick = &params.Nick
+	return params, nil
+}
+
+func getMembers(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	q := r.URL.Query()
+	limit := 1
+	if q.Get("limit") != "" {
+		limit, err = strconv.Atoi(q.Get("limit"))
+		if err != nil || limit < 1 || limit > 1000 {
+			return nil, errBadRequest(errors.New("limit must be between 1 and 1000"))
+		}
+	}
+	after := q.Get("after")
+	if after == "" {
+		after = "0"
+	}
+
+	members := []*Member{}
+	for _, m := range g.members {
+		if idLess(after, m.User.ID) {
+			members = append(members, m)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return idLess(members[i].User.ID, members[j].User.ID)
+	})
+	if len(members) > limit {
+		members = members[:limit]
+	}
+	return members, nil
+}
+
+func getMember(s *Server, r *request) (interface{}, error) {
+	_, m, err := s.guildMember(r)
+	return m, err
+}
+
+func addMember(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	u, ok := s.users[r.params["user"]]
+	if !ok {
+		return nil, errUnknownUser
+	}
+	if m, ok := g.members[u.ID]; ok {
+		return m, nil
+	}
+	var params struct {
+		Nick *string `json:"nick"`
+		Mute bool    `json:"mute"`
+		Deaf bool    `json:"deaf"`
+	}
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	m := &Member{
+		User:     u,
+		Nick:     params.Nick,
+		Roles:    []string{},
+		JoinedAt: time.Now(),
+		Mute:     params.Mute,
+		Deaf:     params.Deaf,
+	}
+	g.members[u.ID] = m
+	return m, nil
+}
+
+// roleIDs accepts both role IDs and role objects.
+func roleIDs(raw json.RawMessage) ([]string, error) {
+	var ids []string
+	err := json.Unmarshal(raw, &ids)
+	if err == nil {
+		return ids, nil
+	}
+	var roles []*Role
+	err = json.Unmarshal(raw, &roles)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		ids = append(ids, r.ID)
+	}
+	return ids, nil
+}
+
+func (g *guild) role(rID string) *Role {
+	for _, r := range g.Roles {
+		if r.ID == rID {
+			return r
+		}
+	}
+	return nil
+}
+
+func modifyMember(s *Server, r *request) (interface{}, error) {
+	g, m, err := s.guildMember(r)
+	if err != nil {
+		return nil, err
+	}
+	var params struct {
+		Nick      *string         `json:"nick"`
+		Roles     json.RawMessage `json:"roles"`
+		Mute      *bool           `json:"mute"`
+		Deaf      *bool           `json:"deaf"`
+		ChannelID *string         `json:"channel_id"`
+	}
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Roles != nil {
+		ids, err := roleIDs(params.Roles)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if g.role(id) == nil {
+				return nil, errUnknownRole
+			}
+		}
+		m.Roles = ids
+	}
+	if params.Nick != nil {
+		m.Nick = params.Nick
+	}
+	if params.Mute != nil {
+		m.Mute = *params.Mute
+	}
+	if params.Deaf != nil {
+		m.Deaf = *params.Deaf
+	}
+	return nil, nil
+}
+
+func removeMember(s *Server, r *request) (interface{}, error) {
+	g, m, err := s.guildMember(r)
+	if err != nil {
+		return nil, err
+	}
+	delete(g.members, m.User.ID)
+	return nil, nil
+}
+
+func addMemberRole(s *Server, r *request) (interface{}, error) {
+	g, m, err := s.guildMember(r)
+	if err != nil {
+		return nil, err
+	}
+	if g.role(r.params["role"]) == nil {
+		return nil, errUnknownRole
+	}
+	for _, id := range m.Roles {
+		if id == r.params["role"] {
+			return nil, nil
+		}
+	}
+	m.Roles = append(m.Roles, r.params["role"])
+	return nil, nil
+}
+
+func removeMemberRole(s *Server, r *request) (interface{}, error) {
+	_, m, err := s.guildMember(r)
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range m.Roles {
+		if id == r.params["role"] {
+			m.Roles = append(m.Roles[:i], m.Roles[i+1:]...)
+			break
+		}
+	}
+	return nil, nil
+}
+
+func getBans(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	users := []*User{}
+	for _, u := range g.bans {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return idLess(users[i].ID, users[j].ID)
+	})
+	return users, nil
+}
+
+func createBan(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	u, ok := s.users[r.params["user"]]
+	if !ok {
+		return nil, errUnknownUser
+	}
+	g.bans[u.ID] = u
+	delete(g.members, u.ID)
+	return nil, nil
+}
+
+func removeBan(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := g.bans[r.params["user"]]; !ok {
+		return nil, errUnknownBan
+	}
+	delete(g.bans, r.params["user"])
+	return nil, nil
+}
+
+func getRoles(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	return g.Roles, nil
+}
+
+type roleParams struct {
+	Name        *string `json:"name"`
+	Permissions *int    `json:"permissions"`
+	Color       *int    `json:"color"`
+	Hoist       *bool   `json:"hoist"`
+	Mentionable *bool   `json:"mentionable"`
+}
+
+func (params *roleParams) apply(role *Role) {
+	if params.Name != nil {
+		role.Name = *params.Name
+	}
+	if params.Permissions != nil {
+		role.Permissions = *params.Permissions
+	}
+	if params.Color != nil {
+		role.Color = *params.Color
+	}
+	if params.Hoist != nil {
+		role.Hoist = *params.Hoist
+	}
+	if params.Mentionable != nil {
+		role.Mentionable = *params.Mentionable
+	}
+}
+
+func createRole(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Roles) >= 250 {
+		return nil, &apiError{status: http.StatusBadRequest, Code: 30005, Message: "Maximum number of guild roles reached (250)"}
+	}
+	var params roleParams
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	role := &Role{
+		ID:       s.newID(),
+		Name:     "new role",
+		Position: len(g.Roles),
+	}
+	params.apply(role)
+	g.Roles = append(g.Roles, role)
+	return role, nil
+}
+
+func modifyRolePositions(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	var params []struct {
+		ID       string `json:"id"`
+		Position int    `json:"position"`
+	}
+	// A single position is accepted too.
+	var raw json.RawMessage
+	err = decode(r, &raw)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "{") {
+		raw = append(append(json.RawMessage("["), raw...), ']')
+	}
+	err = json.Unmarshal(raw, &params)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range params {
+		role := g.role(p.ID)
+		if role == nil {
+			return nil, errUnknownRole
+		}
+		role.Position = p.Position
+	}
+	return g.Roles, nil
+}
+
+func modifyRole(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	role := g.role(r.params["role"])
+	if role == nil {
+		return nil, errUnknownRole
+	}
+	var params roleParams
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	params.apply(role)
+	return role, nil
+}
+
+func deleteRole(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	for i, role := range g.Roles {
+		if role.ID == r.params["role"] {
+			g.Roles = append(g.Roles[:i], g.Roles[i+1:]...)
+			for _, m := range g.members {
+				for j, id := range m.Roles {
+					if id == role.ID {
+						m.Roles = append(m.Roles[:j], m.Roles[j+1:]...)
+						break
+					}
+				}
+			}
+			return nil, nil
+		}
+	}
+	return nil, errUnknownRole
+}
+
+func prune(s *Server, r *request) (interface{}, error) {
+	_, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	// Nobody is ever inactive.
+	return map[string]int{"pruned": 0}, nil
+}
+
+func getGuildInvites(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	return s.invitesWhere(func(inv *Invite) bool {
+		return inv.Guild != nil && inv.Guild.ID == g.ID
+	}), nil
+}
+
+func getIntegrations(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	integrations := []*Integration{}
+	for _, i := range g.integrations {
+		integrations = append(integrations, i)
+	}
+	sort.Slice(integrations, func(i, j int) bool {
+		return idLess(integrations[i].ID, integrations[j].ID)
+	})
+	return integrations, nil
+}
+
+func createIntegration(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	var params struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	g.integrations[params.ID] = &Integration{
+		ID:      params.ID,
+		Name:    params.Type,
+		Type:    params.Type,
+		Enabled: true,
+	}
+	return nil, nil
+}
+
+func (s *Server) integration(r *request) (*guild, *Integration, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, nil, err
+	}
+	i, ok := g.integrations[r.params["integration"]]
+	if !ok {
+		return nil, nil, errUnknownIntegration
+	}
+	return g, i, nil
+}
+
+func modifyIntegration(s *Server, r *request) (interface{}, error) {
+	_, i, err := s.integration(r)
+	if err != nil {
+		return nil, err
+	}
+	var params struct {
+		ExpireBehaviour   *int `json:"expire_behaviour"`
+		ExpireGracePeriod *int `json:"expire_grace_period"`
+	}
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	if params.ExpireBehaviour != nil {
+		i.ExpireBehaviour = *params.ExpireBehaviour
+	}
+	if params.ExpireGracePeriod != nil {
+		i.ExpireGracePeriod = *params.ExpireGracePeriod
+	}
+	return nil, nil
+}
+
+func deleteIntegration(s *Server, r *request) (interface{}, error) {
+	g, i, err := s.integration(r)
+	if err != nil {
+		return nil, err
+	}
+	delete(g.integrations, i.ID)
+	return nil, nil
+}
+
+func syncIntegration(s *Server, r *request) (interface{}, error) {
+	_, _, err := s.integration(r)
+	return nil, err
+}
+
+func getGuildEmbed(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	return g.embed, nil
+}
+
+func modifyGuildEmbed(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	var params struct {
+		Enabled   *bool   `json:"enabled"`
+		ChannelID *string `json:"channel_id"`
+	}
+	err = decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Enabled != nil {
+		g.embed.Enabled = *params.Enabled
+	}
+	if params.ChannelID != nil {
+		g.embed.ChannelID = *params.ChannelID
+	}
+	return g.embed, nil
+}
+
+func getMe(s *Server, r *request) (interface{}, error) {
+	return s.Me, nil
+}
+
+func modifyMe(s *Server, r *request) (interface{}, error) {
+	var params struct {
+		Username *string `json:"username"`
+		Avatar   *string `json:"avatar"`
+	}
+	err := decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Username != nil && *params.Username != "" {
+		s.Me.Username = *params.Username
+	}
+	if params.Avatar != nil && *params.Avatar != "" {
+		s.Me.Avatar = strconv.FormatUint(uint64(len(*params.Avatar)), 16)
+	}
+	return s.Me, nil
+}
+
+func getMyGuilds(s *Server, r *request) (interface{}, error) {
+	type userGuild struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		Icon        string `json:"icon,omitempty"`
+		Owner       bool   `json:"owner"`
+		Permissions int    `json:"permissions"`
+	}
+	q := r.URL.Query()
+	limit := 100
+	if q.Get("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(q.Get("limit"))
+		if err != nil || limit < 1 || limit > 100 {
+			return nil, errBadRequest(errors.New("limit must be between 1 and 100"))
+		}
+	}
+
+	guilds := []*userGuild{}
+	for _, g := range s.guilds {
+		if q.Get("before") != "" && !idLess(g.ID, q.Get("before")) {
+			continue
+		}
+		if q.Get("after") != "" && !idLess(q.Get("after"), g.ID) {
+			continue
+		}
+		guilds = append(guilds, &userGuild{
+			ID:    g.ID,
+			Name:  g.Name,
+			Icon:  g.Icon,
+			Owner: g.OwnerID == s.Me.ID,
+		})
+	}
+	sort.Slice(guilds, func(i, j int) bool {
+		return idLess(guilds[i].ID, guilds[j].ID)
+	})
+	if len(guilds) > limit {
+		guilds = guilds[:limit]
+	}
+	return guilds, nil
+}
+
+func leaveGuild(s *Server, r *request) (interface{}, error) {
+	g, err := s.guild(r.params["guild"])
+	if err != nil {
+		return nil, err
+	}
+	if g.OwnerID == s.Me.ID {
+		return nil, errBadRequest(errors.New("the owner cannot leave the guild"))
+	}
+	delete(s.guilds, g.ID)
+	return nil, nil
+}
+
+func (s *Server) dmChannels() []*Channel {
+	channels := []*Channel{}
+	for _, ch := range s.channels {
+		if ch.Type == ChannelTypeDM || ch.Type == ChannelTypeGroupDM {
+			channels = append(channels, ch)
+		}
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return idLess(channels[i].ID, channels[j].ID)
+	})
+	return channels
+}
+
+func getDMChannels(s *Server, r *request) (interface{}, error) {
+	return s.dmChannels(), nil
+}
+
+func createDMChannel(s *Server, r *request) (interface{}, error) {
+	var params struct {
+		RecipientID  string            `json:"recipient_id"`
+		AccessTokens []string          `json:"access_tokens"`
+		Nicks        map[string]string `json:"nicks"`
+	}
+	err := decode(r, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.RecipientID == "" {
+		ch := &Channel{
+			ID:         s.newID(),
+			Type:       ChannelTypeGroupDM,
+			Recipients: []*User{},
+		}
+		for uID := range params.Nicks {
+			if u, ok := s.users[uID]; ok {
+				ch.Recipients = append(ch.Recipients, u)
+			}
+		}
+		s.channels[ch.ID] = ch
+		return ch, nil
+	}
+
+	u, ok := s.users[params.RecipientID]
+	if !ok {
+		return nil, errUnknownUser
+	}
+	for _, ch := range s.dmChannels() {
+		if ch.Type == ChannelTypeDM && len(ch.Recipients) == 1 && ch.Recipients[0].ID == u.ID {
+			return ch, nil
+		}
+	}
+	ch := &Channel{
+		ID:         s.newID(),
+		Type:       ChannelTypeDM,
+		Recipients: []*User{u},
+	}
+	s.channels[ch.ID] = ch
+	return ch, nil
+}
+
+func getConnections(s *Server, r *request) (interface{}, error) {
+	// Bots have no connections.
+	return []struct{}{}, nil
+}
+
+func getUser(s *Server, r *request) (interface{}, error) {
+	u, ok := s.users[r.params["user"]]
+	if !ok {
+		return nil, errUnknownUser
+	}
+	return u, nil
+}
+
+func getInvite(s *Server, r *request) (interface{}, error) {
+	inv, ok := s.invites[r.params["invite"]]
+	if !ok {
+		return nil, errUnknownInvite
+	}
+	return inv, nil
+}
+
+func deleteInvite(s *Server, r *request) (interface{}, error) {
+	inv, ok := s.invites[r.params["invite"]]
+	if !ok {
+		return nil, errUnknownInvite
+	}
+	delete(s.invites, inv.Code)
+	return inv, nil
+}
+
+func acceptInvite(s *Server, r *request) (interface{}, error) {
+	if _, ok := s.invites[r.params["invite"]]; !ok {
+		return nil, errUnknownInvite
+	}
+	return nil, &apiError{status: http.StatusForbidden, Code: 20001, Message: "Bots cannot use this endpoint"}
+}
@@ -0,0 +1,510 @@
+// Package discgotest provides a fake Discord API for tests.
+package discgotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is the number of requests allowed per window on every route and
+// major parameter.
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+var DefaultRateLimit = RateLimit{Limit: 5, Window: time.Second}
+
+// Server is a fake Discord REST API backed by in memory guilds, channels, messages,
+// roles and members. Use URL as the BaseURL of a discgo.RESTClient.
+// Only requests with the token of the Server are authorized.
+type Server struct {
+	// Base URL of the API.
+	URL string
+
+	Token string
+	// The user of the bot that owns the token.
+	Me *User
+	// Returned by the gateway routes.
+	GatewayURL string
+	// The recommended number of shards returned by the gateway/bot route.
+	Shards int
+
+	srv *httptest.Server
+
+	mu           sync.Mutex
+	rateLimit    RateLimit
+	windows      map[string]*window
+	rateLimited  int
+	nextID       uint64
+	users        map[string]*User
+	guilds       map[string]*guild
+	channels     map[string]*Channel
+	messages     map[string][]*Message
+	invites      map[string]*Invite
+	voiceRegions []*VoiceRegion
+}
+
+type guild struct {
+	*Guild
+	members      map[string]*Member
+	bans         map[string]*User
+	integrations map[string]*Integration
+	embed        GuildEmbed
+}
+
+type window struct {
+	reset     time.Time
+	remaining int
+}
+
+// NewServer starts a Server authorizing the given token.
+// The server must be closed with Close.
+func NewServer(token string) *Server {
+	s := &Server{
+		Token: token,
+		Me: &User{
+			Discriminator: "0001",
+			Username:      "discgotest",
+			Bot:           true,
+		},
+		GatewayURL: "wss://gateway.discord.gg",
+		Shards:     1,
+		rateLimit:  DefaultRateLimit,
+		windows:    make(map[string]*window),
+		users:      make(map[string]*User),
+		guilds:     make(map[string]*guild),
+		channels:   make(map[string]*Channel),
+		messages:   make(map[string][]*Message),
+		invites:    make(map[string]*Invite),
+		voiceRegions: []*VoiceRegion{
+			{ID: "us-east", Name: "US East", Optimal: true},
+			{ID: "eu-west", Name: "EU West"},
+		},
+	}
+	s.Me.ID = s.newID()
+	s.users[s.Me.ID] = s.Me
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL + "/api"
+	return s
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// SetRateLimit changes the rate limit of every route.
+func (s *Server) SetRateLimit(rl RateLimit) {
+	s.mu.Lock()
+	s.rateLimit = rl
+	s.windows = make(map[string]*window)
+	s.mu.Unlock()
+}
+
+// RateLimited returns how many requests were rejected with a 429.
+func (s *Server) RateLimited() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rateLimited
+}
+
+const discordEpoch = 1420070400000
+
+// newID returns a new snowflake. They always increase.
+func (s *Server) newID() string {
+	s.nextID++
+	id := uint64(time.Now().UnixNano()/int64(time.Millisecond)-discordEpoch) << 22
+	if id > s.nextID {
+		s.nextID = id
+	}
+	return strconv.FormatUint(s.nextID, 10)
+}
+
+// AddUser adds a user. If its ID is empty, one is generated.
+func (s *Server) AddUser(u *User) *User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u.ID == "" {
+		u.ID = s.newID()
+	}
+	s.users[u.ID] = u
+	return u
+}
+
+// AddGuild adds a guild and makes the bot a member of it.
+// If its ID is empty, one is generated.
+func (s *Server) AddGuild(g *Guild) *Guild {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addGuild(g)
+}
+
+func (s *Server) addGuild(g *Guild) *Guild {
+	if g.ID == "" {
+		g.ID = s.newID()
+	}
+	if g.OwnerID == "" {
+		g.OwnerID = s.Me.ID
+	}
+	if g.JoinedAt.IsZero() {
+		g.JoinedAt = time.Now()
+	}
+	if len(g.Roles) == 0 {
+		// Every guild has an @everyone role with the same ID as the guild.
+		g.Roles = []*Role{{ID: g.ID, Name: "@everyone"}}
+	}
+	s.guilds[g.ID] = &guild{
+		Guild: g,
+		members: map[string]*Member{
+			s.Me.ID: {User: s.Me, Roles: []string{}, JoinedAt: g.JoinedAt},
+		},
+		bans:         make(map[string]*User),
+		integrations: make(map[string]*Integration),
+	}
+	return g
+}
+
+// AddMember adds a member to a guild. The user is added too if it does not exist.
+func (s *Server) AddMember(gID string, m *Member) *Member {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.guilds[gID]
+	if m.User.ID == "" {
+		m.User.ID = s.newID()
+	}
+	if _, ok := s.users[m.User.ID]; !ok {
+		s.users[m.User.ID] = m.User
+	}
+	if m.JoinedAt.IsZero() {
+		m.JoinedAt = time.Now()
+	}
+	if m.Roles == nil {
+		m.Roles = []string{}
+	}
+	g.members[m.User.ID] = m
+	return m
+}
+
+// AddRole adds a role to a guild. If its ID is empty, one is generated.
+func (s *Server) AddRole(gID string, r *Role) *Role {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.ID == "" {
+		r.ID = s.newID()
+	}
+	g := s.guilds[gID]
+	g.Roles = append(g.Roles, r)
+	return r
+}
+
+// AddChannel adds a channel. If its ID is empty, one is generated.
+func (s *Server) AddChannel(ch *Channel) *Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ch.ID == "" {
+		ch.ID = s.newID()
+	}
+	s.channels[ch.ID] = ch
+	return ch
+}
+
+// AddMessage adds a message to its channel. If its ID is empty, one is generated.
+// If the author is nil, the bot is the author.
+func (s *Server) AddMessage(m *Message) *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addMessage(m)
+}
+
+func (s *Server) addMessage(m *Message) *Message {
+	if m.ID == "" {
+		m.ID = s.newID()
+	}
+	if m.Author == nil {
+		m.Author = s.Me
+	}
+	if m.Timestamp.IsZero() {
+		m.Timestamp = time.Now()
+	}
+	if m.Mentions == nil {
+		m.Mentions = []*User{}
+	}
+	if m.MentionRoles == nil {
+		m.MentionRoles = []string{}
+	}
+	if m.Attachments == nil {
+		m.Attachments = []*Attachment{}
+	}
+	if m.Embeds == nil {
+		m.Embeds = []json.RawMessage{}
+	}
+	// Reactions are added with AddReaction.
+	m.Reactions = nil
+	s.messages[m.ChannelID] = append(s.messages[m.ChannelID], m)
+	if ch, ok := s.channels[m.ChannelID]; ok {
+		ch.LastMessageID = m.ID
+	}
+	return m
+}
+
+// AddReaction adds a reaction by the user to the message.
+func (s *Server) AddReaction(cID, mID, emoji, uID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.message(cID, mID)
+	addReaction(m, emoji, uID)
+}
+
+// AddInvite adds an invite. If its code is empty, one is generated.
+func (s *Server) AddInvite(inv *Invite) *Invite {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if inv.Code == "" {
+		inv.Code = s.newID()
+	}
+	if inv.CreatedAt.IsZero() {
+		inv.CreatedAt = time.Now()
+	}
+	s.invites[inv.Code] = inv
+	return inv
+}
+
+// Messages returns the messages of the channel from oldest to newest.
+func (s *Server) Messages(cID string) []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Message(nil), s.messages[cID]...)
+}
+
+// Guild returns the guild with the ID or nil.
+func (s *Server) Guild(gID string) *Guild {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.guilds[gID]
+	if !ok {
+		return nil
+	}
+	return g.Guild
+}
+
+// Channel returns the channel with the ID or nil.
+func (s *Server) Channel(cID string) *Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channels[cID]
+}
+
+// Member returns the member of the guild or nil.
+func (s *Server) Member(gID, uID string) *Member {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.guilds[gID]
+	if !ok {
+		return nil
+	}
+	return g.members[uID]
+}
+
+// apiError is a Discord JSON error response.
+type apiError struct {
+	status  int
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (err *apiError) Error() string {
+	return err.Message
+}
+
+func errUnknown(code int, what string) *apiError {
+	return &apiError{status: http.StatusNotFound, Code: code, Message: "Unknown " + what}
+}
+
+var (
+	errUnauthorized       = &apiError{status: http.StatusUnauthorized, Code: 0, Message: "401: Unauthorized"}
+	errNotFound           = &apiError{status: http.StatusNotFound, Code: 0, Message: "404: Not Found"}
+	errMethodNotAllowed   = &apiError{status: http.StatusMethodNotAllowed, Code: 0, Message: "405: Method Not Allowed"}
+	errMissingPermissions = &apiError{status: http.StatusForbidden, Code: 50013, Message: "Missing Permissions"}
+	errUnknownChannel     = errUnknown(10003, "Channel")
+	errUnknownGuild       = errUnknown(10004, "Guild")
+	errUnknownInvite      = errUnknown(10006, "Invite")
+	errUnknownMember      = errUnknown(10007, "Member")
+	errUnknownMessage     = errUnknown(10008, "Message")
+	errUnknownOverwrite   = errUnknown(10009, "Overwrite")
+	errUnknownRole        = errUnknown(10011, "Role")
+	errUnknownUser        = errUnknown(10013, "User")
+	errUnknownBan         = errUnknown(10026, "Ban")
+	errUnknownIntegration = errUnknown(10005, "Integration")
+	errUnknownEmoji       = errUnknown(10014, "Emoji")
+)
+
+func errBadRequest(err error) *apiError {
+	return &apiError{status: http.StatusBadRequest, Code: 50035, Message: err.Error()}
+}
+
+type request struct {
+	*http.Request
+	params map[string]string
+}
+
+// handler is called with Server.mu locked. If it returns nil, nil the response is a 204.
+type handler func(s *Server, r *request) (interface{}, error)
+
+type route struct {
+	method   string
+	elements []string
+	handler  handler
+}
+
+func (rt *route) match(elements []string) (map[string]string, bool) {
+	if len(elements) != len(rt.elements) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, e := range rt.elements {
+		if strings.HasPrefix(e, "{") {
+			params[e[1:len(e)-1]] = elements[i]
+		} else if e != elements[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/api")
+	// Accept any API version.
+	if strings.HasPrefix(path, "/v") {
+		i := strings.Index(path[1:], "/")
+		if i == -1 {
+			writeJSON(w, http.StatusNotFound, errNotFound)
+			return
+		}
+		path = path[i+1:]
+	}
+	elements := strings.Split(strings.Trim(path, "/"), "/")
+	for i, e := range elements {
+		e, err := url.PathUnescape(e)
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, errNotFound)
+			return
+		}
+		elements[i] = e
+	}
+
+	var rt *route
+	var params map[string]string
+	var pathMatched bool
+	for i := range routes {
+		p, ok := routes[i].match(elements)
+		if !ok {
+			continue
+		}
+		pathMatched = true
+		if routes[i].method == r.Method {
+			rt = &routes[i]
+			params = p
+			break
+		}
+	}
+	if rt == nil {
+		if pathMatched {
+			writeJSON(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusNotFound, errNotFound)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bot "+s.Token {
+		writeJSON(w, http.StatusUnauthorized, errUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.takeRateLimit(w, rt, params) {
+		return
+	}
+
+	v, err := rt.handler(s, &request{r, params})
+	if err != nil {
+		apiErr, ok := err.(*apiError)
+		if !ok {
+			apiErr = errBadRequest(err)
+		}
+		writeJSON(w, apiErr.status, apiErr)
+		return
+	}
+	if v == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+// takeRateLimit writes the rate limit headers and reports whether the request may proceed.
+// If not, it writes a 429.
+func (s *Server) takeRateLimit(w http.ResponseWriter, rt *route, params map[string]string) bool {
+	bucket := rt.method + " " + strings.Join(rt.elements, "/")
+	h := fnv.New64a()
+	h.Write([]byte(bucket))
+	bucketHash := strconv.FormatUint(h.Sum64(), 16)
+
+	key := bucket
+	for _, major := range []string{"channel", "guild"} {
+		if id, ok := params[major]; ok {
+			key += ":" + id
+		}
+	}
+
+	now := time.Now()
+	win, ok := s.windows[key]
+	if !ok || !win.reset.After(now) {
+		win = &window{
+			reset:     now.Add(s.rateLimit.Window),
+			remaining: s.rateLimit.Limit,
+		}
+		s.windows[key] = win
+	}
+
+	reset := float64(win.reset.UnixNano()) / float64(time.Second)
+	w.Header().Set("X-RateLimit-Bucket", bucketHash)
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(s.rateLimit.Limit))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatFloat(reset, 'f', 3, 64))
+
+	if win.remaining <= 0 {
+		s.rateLimited++
+		retryAfter := win.reset.Sub(now) / time.Millisecond
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(retryAfter), 10))
+		writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"message":     "You are being rate limited.",
+			"retry_after": int64(retryAfter),
+			"global":      false,
+		})
+		return false
+	}
+	win.remaining--
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(win.remaining))
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("failed to marshal response: %v", err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
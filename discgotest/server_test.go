@@ -0,0 +1,83 @@
+package discgotest
+
+import (
+	"net/http"
+	"testing"
+)
+
+func get(t *testing.T, s *Server, path, token string) *http.Response {
+	req, err := http.NewRequest("GET", s.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bot "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestServer_Status(t *testing.T) {
+	s := NewServer("token")
+	defer s.Close()
+	ch := s.AddChannel(&Channel{Name: "general"})
+
+	testCases := []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{"/v6/channels/" + ch.ID, "token", http.StatusOK},
+		{"/v6/channels/" + ch.ID, "wrong", http.StatusUnauthorized},
+		{"/v6/channels/1", "token", http.StatusNotFound},
+		{"/v6/channels/" + ch.ID + "/typing", "token", http.StatusMethodNotAllowed},
+		{"/v6/nope", "token", http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		resp := get(t, s, tc.path, tc.token)
+		if resp.StatusCode != tc.status {
+			t.Fatalf("expected %v but got %v for %v", tc.status, resp.StatusCode, tc.path)
+		}
+	}
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	s := NewServer("token")
+	defer s.Close()
+	s.SetRateLimit(RateLimit{Limit: 2, Window: DefaultRateLimit.Window})
+	ch1 := s.AddChannel(&Channel{Name: "general"})
+	ch2 := s.AddChannel(&Channel{Name: "random"})
+
+	for i, expected := range []string{"1", "0"} {
+		resp := get(t, s, "/v6/channels/"+ch1.ID, "token")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %v but got %v on request %v", http.StatusOK, resp.StatusCode, i)
+		}
+		remaining := resp.Header.Get("X-RateLimit-Remaining")
+		if remaining != expected {
+			t.Fatalf("expected %v but got %v", expected, remaining)
+		}
+	}
+
+	resp := get(t, s, "/v6/channels/"+ch1.ID, "token")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected %v but got %v", http.StatusTooManyRequests, resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After header")
+	}
+	if s.RateLimited() != 1 {
+		t.Fatalf("expected %v but got %v", 1, s.RateLimited())
+	}
+
+	// Another major parameter has its own window but the same bucket.
+	resp2 := get(t, s, "/v6/channels/"+ch2.ID, "token")
+	if resp2.StatusCode != http.StatusOK {
+		t.Fatalf("expected %v but got %v", http.StatusOK, resp2.StatusCode)
+	}
+	if resp.Header.Get("X-RateLimit-Bucket") != resp2.Header.Get("X-RateLimit-Bucket") {
+		t.Fatalf("expected %v but got %v", resp.Header.Get("X-RateLimit-Bucket"), resp2.Header.Get("X-RateLimit-Bucket"))
+	}
+}
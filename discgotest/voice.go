@@ -0,0 +1,367 @@
+package discgotest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Voice gateway opcodes.
+const (
+	VoiceOpIdentify = iota
+	VoiceOpSelectProtocol
+	VoiceOpReady
+	VoiceOpHeartbeat
+	VoiceOpSessionDescription
+	VoiceOpSpeaking
+	VoiceOpHeartbeatACK
+	VoiceOpResume
+	VoiceOpHello
+	VoiceOpClientDisconnect = 13
+)
+
+// Voice gateway close codes.
+// They are untyped as discgo's tests import this package, they match discgo.VoiceCloseCode.
+const (
+	VoiceCloseUnknownOpcode        = 4001
+	VoiceCloseNotAuthenticated     = 4003
+	VoiceCloseAuthenticationFailed = 4004
+	VoiceCloseAlreadyAuthenticated = 4005
+	VoiceCloseUnknownProtocol      = 4012
+	VoiceCloseUnknownEncryption    = 4016
+)
+
+// VoiceMode is the only encryption mode supported by the VoiceServer.
+const VoiceMode = "xsalsa20_poly1305"
+
+// VoicePacket is an RTP packet received or sent by the VoiceServer.
+type VoicePacket struct {
+	Sequence  uint16
+	Timestamp uint32
+	SSRC      uint32
+	Opus      []byte
+}
+
+// VoiceServer is a fake Discord voice server. It has a voice gateway that
+// answers Identify with Ready and Select Protocol with a Session Description and
+// acknowledges heartbeats, and a UDP socket that answers IP discovery and decrypts audio.
+// Audio of other users is scripted by the test with Speaking, SendPacket and ClientDisconnect.
+type VoiceServer struct {
+	// Use as the VoiceEndpoint of a Gateway.
+	URL string
+	// Defaults to VoiceToken.
+	Token string
+	// Sent in Hello. Must be set before the first connection.
+	HeartbeatInterval time.Duration
+	// Given to the client in Ready.
+	SSRC      uint32
+	SecretKey [32]byte
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+	udpConn  *net.UDPConn
+
+	mu   sync.Mutex
+	conn *gatewayConn
+	// Learned from IP discovery.
+	clientAddr *net.UDPAddr
+	payloads   []*GatewayPayload
+	packets    []*VoicePacket
+	// Closed and replaced whenever a payload or packet is received.
+	received chan struct{}
+}
+
+// NewVoiceServer starts a VoiceServer.
+// The server must be closed with Close.
+func NewVoiceServer() *VoiceServer {
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		panic(err)
+	}
+	vs := &VoiceServer{
+		Token:             VoiceToken,
+		HeartbeatInterval: DefaultHeartbeatInterval,
+		SSRC:              1,
+		udpConn:           udpConn,
+		received:          make(chan struct{}),
+	}
+	_, err = rand.Read(vs.SecretKey[:])
+	if err != nil {
+		panic(err)
+	}
+	vs.srv = httptest.NewServer(http.HandlerFunc(vs.serveHTTP))
+	vs.URL = "ws" + strings.TrimPrefix(vs.srv.URL, "http")
+	go vs.serveUDP()
+	return vs
+}
+
+// Close drops the connection and stops the server.
+func (vs *VoiceServer) Close() {
+	vs.mu.Lock()
+	if vs.conn != nil {
+		vs.conn.ws.Close()
+	}
+	vs.mu.Unlock()
+	vs.udpConn.Close()
+	vs.srv.Close()
+}
+
+// Next waits for the next payload received with the given opcode.
+// Payloads received before it are discarded.
+func (vs *VoiceServer) Next(ctx context.Context, op int) (*GatewayPayload, error) {
+	for {
+		vs.mu.Lock()
+		for i, p := range vs.payloads {
+			if p.Op == op {
+				vs.payloads = vs.payloads[i+1:]
+				vs.mu.Unlock()
+				return p, nil
+			}
+		}
+		vs.payloads = nil
+		received := vs.received
+		vs.mu.Unlock()
+
+		select {
+		case <-received:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// NextPacket waits for the next audio packet.
+func (vs *VoiceServer) NextPacket(ctx context.Context) (*VoicePacket, error) {
+	for {
+		vs.mu.Lock()
+		if len(vs.packets) > 0 {
+			p := vs.packets[0]
+			vs.packets = vs.packets[1:]
+			vs.mu.Unlock()
+			return p, nil
+		}
+		received := vs.received
+		vs.mu.Unlock()
+
+		select {
+		case <-received:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// notify is called with vs.mu locked.
+func (vs *VoiceServer) notify() {
+	close(vs.received)
+	vs.received = make(chan struct{})
+}
+
+func (vs *VoiceServer) serveUDP() {
+	b := make([]byte, 2048)
+	for {
+		n, addr, err := vs.udpConn.ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+		if n == 70 && binary.BigEndian.Uint32(b) == vs.SSRC {
+			vs.answerIPDiscovery(addr)
+			continue
+		}
+		if n < 12 {
+			continue
+		}
+		var nonce [24]byte
+		copy(nonce[:], b[:12])
+		opus, ok := secretbox.Open(nil, b[12:n], &nonce, &vs.SecretKey)
+		if !ok {
+			continue
+		}
+		vs.mu.Lock()
+		vs.packets = append(vs.packets, &VoicePacket{
+			Sequence:  binary.BigEndian.Uint16(b[2:]),
+			Timestamp: binary.BigEndian.Uint32(b[4:]),
+			SSRC:      binary.BigEndian.Uint32(b[8:]),
+			Opus:      opus,
+		})
+		vs.notify()
+		vs.mu.Unlock()
+	}
+}
+
+// answerIPDiscovery tells the client its external address.
+func (vs *VoiceServer) answerIPDiscovery(addr *net.UDPAddr) {
+	b := make([]byte, 70)
+	binary.BigEndian.PutUint32(b, vs.SSRC)
+	copy(b[4:68], addr.IP.String())
+	binary.LittleEndian.PutUint16(b[68:], uint16(addr.Port))
+	vs.udpConn.WriteToUDP(b, addr)
+	vs.mu.Lock()
+	vs.clientAddr = addr
+	vs.mu.Unlock()
+}
+
+// Speaking tells the client that the user speaks with the SSRC.
+func (vs *VoiceServer) Speaking(userID string, ssrc uint32, speaking bool) error {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if vs.conn == nil {
+		return errNoConnection
+	}
+	return vs.conn.writeOp(VoiceOpSpeaking, map[string]interface{}{
+		"user_id":  userID,
+		"ssrc":     ssrc,
+		"speaking": speaking,
+	})
+}
+
+// ClientDisconnect tells the client that the user left the channel.
+func (vs *VoiceServer) ClientDisconnect(userID string) error {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	if vs.conn == nil {
+		return errNoConnection
+	}
+	return vs.conn.writeOp(VoiceOpClientDisconnect, map[string]interface{}{
+		"user_id": userID,
+	})
+}
+
+// SendPacket encrypts the packet and sends it to the client.
+func (vs *VoiceServer) SendPacket(p *VoicePacket) error {
+	vs.mu.Lock()
+	addr := vs.clientAddr
+	vs.mu.Unlock()
+	if addr == nil {
+		return errNoConnection
+	}
+	b := make([]byte, 12, 12+len(p.Opus)+secretbox.Overhead)
+	b[0] = 0x80
+	b[1] = 0x78
+	binary.BigEndian.PutUint16(b[2:], p.Sequence)
+	binary.BigEndian.PutUint32(b[4:], p.Timestamp)
+	binary.BigEndian.PutUint32(b[8:], p.SSRC)
+	var nonce [24]byte
+	copy(nonce[:], b)
+	b = secretbox.Seal(b, p.Opus, &nonce, &vs.SecretKey)
+	_, err := vs.udpConn.WriteToUDP(b, addr)
+	return err
+}
+
+func (vs *VoiceServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := vs.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &gatewayConn{ws: ws}
+
+	vs.mu.Lock()
+	vs.conn = c
+	err = c.writeOp(VoiceOpHello, map[string]interface{}{
+		"heartbeat_interval": float64(vs.HeartbeatInterval) / float64(time.Millisecond),
+	})
+	vs.mu.Unlock()
+	if err != nil {
+		ws.Close()
+		return
+	}
+
+	identified := false
+	for {
+		var p GatewayPayload
+		err := ws.ReadJSON(&p)
+		if err != nil {
+			ws.Close()
+			return
+		}
+
+		vs.mu.Lock()
+		vs.payloads = append(vs.payloads, &p)
+		vs.notify()
+		vs.onPayload(c, &p, &identified)
+		vs.mu.Unlock()
+	}
+}
+
+// onPayload is called with vs.mu locked.
+func (vs *VoiceServer) onPayload(c *gatewayConn, p *GatewayPayload, identified *bool) {
+	switch p.Op {
+	case VoiceOpIdentify:
+		var identify struct {
+			ServerID  string `json:"server_id"`
+			UserID    string `json:"user_id"`
+			SessionID string `json:"session_id"`
+			Token     string `json:"token"`
+		}
+		err := json.Unmarshal(p.D, &identify)
+		if err != nil || identify.Token != vs.Token || identify.SessionID == "" {
+			vs.closeConn(c, VoiceCloseAuthenticationFailed, "Authentication failed.")
+			return
+		}
+		if *identified {
+			vs.closeConn(c, VoiceCloseAlreadyAuthenticated, "Already authenticated.")
+			return
+		}
+		*identified = true
+		addr := vs.udpConn.LocalAddr().(*net.UDPAddr)
+		c.writeOp(VoiceOpReady, map[string]interface{}{
+			"ssrc":  vs.SSRC,
+			"ip":    addr.IP.String(),
+			"port":  addr.Port,
+			"modes": []string{VoiceMode},
+		})
+	case VoiceOpSelectProtocol:
+		if !*identified {
+			vs.closeConn(c, VoiceCloseNotAuthenticated, "Not authenticated.")
+			return
+		}
+		var selectProtocol struct {
+			Protocol string `json:"protocol"`
+			Data     struct {
+				Mode string `json:"mode"`
+			} `json:"data"`
+		}
+		err := json.Unmarshal(p.D, &selectProtocol)
+		if err != nil || selectProtocol.Protocol != "udp" {
+			vs.closeConn(c, VoiceCloseUnknownProtocol, "Unknown protocol.")
+			return
+		}
+		if selectProtocol.Data.Mode != VoiceMode {
+			vs.closeConn(c, VoiceCloseUnknownEncryption, "Unknown encryption mode.")
+			return
+		}
+		c.writeOp(VoiceOpSessionDescription, map[string]interface{}{
+			"mode":       VoiceMode,
+			"secret_key": vs.SecretKey,
+		})
+	case VoiceOpHeartbeat:
+		c.write(&GatewayPayload{Op: VoiceOpHeartbeatACK, D: p.D})
+	case VoiceOpSpeaking:
+		if !*identified {
+			vs.closeConn(c, VoiceCloseNotAuthenticated, "Not authenticated.")
+		}
+	default:
+		vs.closeConn(c, VoiceCloseUnknownOpcode, "Unknown opcode.")
+	}
+}
+
+func (vs *VoiceServer) closeConn(c *gatewayConn, code int, text string) {
+	if vs.conn == c {
+		vs.conn = nil
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	msg := websocket.FormatCloseMessage(code, text)
+	c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	c.ws.Close()
+}
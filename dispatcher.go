@@ -0,0 +1,166 @@
+package discgo
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"github.com/nhooyr/log"
+)
+
+const (
+	DefaultDispatchWorkers   = 16
+	DefaultDispatchQueueSize = 64
+)
+
+// OverflowPolicy is what a Dispatcher does when the queue of an event is full.
+type OverflowPolicy int
+
+const (
+	// Handle waits for room in the queue. If handlers stay slow, the GatewayClient
+	// eventually stalls as it would without the Dispatcher.
+	OverflowBlock OverflowPolicy = iota
+	// Handle drops the event and returns ErrDispatchQueueFull, which the GatewayClient
+	// reports as an *EventHandlerError. Use ReconnectError to reconnect instead of missing events.
+	OverflowDrop
+)
+
+var (
+	ErrDispatchQueueFull = errors.New("dispatch queue full; dropped event")
+	errDispatcherClosed  = errors.New("dispatcher closed")
+)
+
+// Dispatcher is an EventHandler that runs Handler on a pool of goroutines so that slow handlers
+// do not hold up the GatewayClient's heartbeats.
+// Events of the same guild are handled in order by the same goroutine, as are events of the same channel
+// outside of guilds. Events that belong to neither, like Ready, all go to one goroutine as well.
+//
+// Handler receives a context that is only canceled by Close and its errors are reported to ErrorHandler
+// as *EventHandlerError as Handle does not wait for it.
+// State is not safe for concurrent use so it should handle events before the Dispatcher.
+type Dispatcher struct {
+	Handler EventHandler
+	// Finds the guild of message events. Without it, they are only ordered with the other events of their channel.
+	State        *State
+	Workers      int            // defaults to DefaultDispatchWorkers.
+	QueueSize    int            // per worker, defaults to DefaultDispatchQueueSize.
+	Overflow     OverflowPolicy // defaults to OverflowBlock.
+	ErrorHandler func(err error)
+
+	startOnce sync.Once
+	ctx       context.Context
+	cancel    context.CancelFunc
+	queues    []chan interface{}
+	wg        sync.WaitGroup
+
+	// Held for reading while sending to queues so that Close does not close them under Handle.
+	mu     sync.RWMutex
+	closed bool
+}
+
+func (d *Dispatcher) start() {
+	if d.ErrorHandler == nil {
+		d.ErrorHandler = func(err error) {
+			log.Printf("%v", err)
+		}
+	}
+	workers := d.Workers
+	if workers <= 0 {
+		workers = DefaultDispatchWorkers
+	}
+	queueSize := d.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultDispatchQueueSize
+	}
+
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.queues = make([]chan interface{}, workers)
+	for i := range d.queues {
+		q := make(chan interface{}, queueSize)
+		d.queues[i] = q
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.work(q)
+		}()
+	}
+}
+
+func (d *Dispatcher) work(q chan interface{}) {
+	for e := range q {
+		if d.ctx.Err() != nil {
+			// Closed, discard the rest of the queue.
+			continue
+		}
+		err := d.Handler.Handle(d.ctx, e)
+		if err != nil && err != ErrEventDone {
+			d.ErrorHandler(&EventHandlerError{
+				EventName: eventName(e),
+				Event:     e,
+				Err:       err,
+			})
+		}
+	}
+}
+
+// Handle queues e for its worker.
+func (d *Dispatcher) Handle(ctx context.Context, e interface{}) error {
+	d.startOnce.Do(d.start)
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return errDispatcherClosed
+	}
+
+	q := d.queues[d.worker(e)]
+	if d.Overflow == OverflowDrop {
+		select {
+		case q <- e:
+			return nil
+		default:
+			return ErrDispatchQueueFull
+		}
+	}
+	select {
+	case q <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// worker returns the index of the queue of e.
+func (d *Dispatcher) worker(e interface{}) int {
+	key, ok := EventGuildID(d.State, e)
+	if !ok {
+		key, ok = eventChannelID(e)
+		if !ok {
+			return 0
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+// Close cancels the context of running handlers, discards queued events and waits for
+// the handlers to return. Close the GatewayClient first.
+func (d *Dispatcher) Close() {
+	d.startOnce.Do(d.start)
+	d.cancel()
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	for _, q := range d.queues {
+		close(q)
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+}
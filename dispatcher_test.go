@@ -0,0 +1,169 @@
+package discgo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_Order(t *testing.T) {
+	s := new(State)
+	s.handle(&EventReady{User: &ModelUser{ID: "1"}})
+	gc := &EventGuildCreate{
+		Channels: []*ModelChannel{{ID: "10", GuildID: "2"}},
+	}
+	gc.ID = "2"
+	err := s.handle(gc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unblock := make(chan struct{})
+	other := make(chan struct{})
+	var mu sync.Mutex
+	var handled []interface{}
+	var m EventMux
+	m.OnGuildMemberAdd(func(ctx context.Context, e *EventGuildMemberAdd) error {
+		if e.GuildID == "3" {
+			close(other)
+			return nil
+		}
+		<-unblock
+		return nil
+	})
+	m.OnEvent(func(ctx context.Context, e interface{}) error {
+		mu.Lock()
+		handled = append(handled, e)
+		mu.Unlock()
+		return nil
+	})
+	d := &Dispatcher{
+		Handler: &m,
+		State:   s,
+		Workers: 64,
+	}
+	defer d.Close()
+
+	mc := new(EventMessageCreate)
+	mc.ChannelID = "10"
+	mu2 := new(EventMessageUpdate)
+	mu2.ChannelID = "10"
+	events := []interface{}{&EventGuildMemberAdd{GuildID: "2"}, mc, mu2}
+	for _, e := range events {
+		err := d.Handle(context.Background(), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Other guilds are not held up.
+	err = d.Handle(context.Background(), &EventGuildMemberAdd{GuildID: "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-other:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected other guild to be handled")
+	}
+	close(unblock)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(handled)
+		mu.Unlock()
+		if n == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v events but got %v", 4, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	var guild2 []interface{}
+	for _, e := range handled {
+		if gID, _ := EventGuildID(s, e); gID == "2" {
+			guild2 = append(guild2, e)
+		}
+	}
+	if !reflect.DeepEqual(guild2, events) {
+		t.Fatalf("expected %v but got %v", events, guild2)
+	}
+}
+
+func TestDispatcher_Overflow(t *testing.T) {
+	started := make(chan struct{}, 1)
+	errs := make(chan error, 1)
+	d := &Dispatcher{
+		Handler: EventHandlerFunc(func(ctx context.Context, e interface{}) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return errors.New("owl")
+		}),
+		Workers:   1,
+		QueueSize: 1,
+		Overflow:  OverflowDrop,
+		ErrorHandler: func(err error) {
+			errs <- err
+		},
+	}
+
+	e := new(EventTypingStart)
+	err := d.Handle(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	err = d.Handle(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Handle(context.Background(), e)
+	if err != ErrDispatchQueueFull {
+		t.Fatalf("expected %v but got %v", ErrDispatchQueueFull, err)
+	}
+
+	d.Close()
+	err = <-errs
+	if ehErr, ok := err.(*EventHandlerError); !ok || ehErr.Err.Error() != "owl" {
+		t.Fatalf("expected handler error but got %v", err)
+	}
+	select {
+	case <-started:
+		t.Fatal("expected queued event to be discarded")
+	default:
+	}
+	err = d.Handle(context.Background(), e)
+	if err != errDispatcherClosed {
+		t.Fatalf("expected %v but got %v", errDispatcherClosed, err)
+	}
+	d.Close()
+}
+
+func TestDispatcher_Block(t *testing.T) {
+	unblock := make(chan struct{})
+	d := &Dispatcher{
+		Handler: EventHandlerFunc(func(ctx context.Context, e interface{}) error {
+			<-unblock
+			return nil
+		}),
+		Workers:   1,
+		QueueSize: 1,
+	}
+	defer d.Close()
+	defer close(unblock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = d.Handle(ctx, new(EventTypingStart))
+	}
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v but got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,219 @@
+package discgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrorCode is a Discord JSON error code.
+// It implements error so that the constants below can be used with errors.Is
+// to check the code of an *APIError.
+//
+//	if errors.Is(err, discgo.ErrorCodeUnknownMessage) {
+type ErrorCode int
+
+// See https://discordapp.com/developers/docs/topics/response-codes#json-error-response
+const (
+	ErrorCodeGeneral                          ErrorCode = 0
+	ErrorCodeUnknownAccount                   ErrorCode = 10001
+	ErrorCodeUnknownApplication               ErrorCode = 10002
+	ErrorCodeUnknownChannel                   ErrorCode = 10003
+	ErrorCodeUnknownGuild                     ErrorCode = 10004
+	ErrorCodeUnknownIntegration               ErrorCode = 10005
+	ErrorCodeUnknownInvite                    ErrorCode = 10006
+	ErrorCodeUnknownMember                    ErrorCode = 10007
+	ErrorCodeUnknownMessage                   ErrorCode = 10008
+	ErrorCodeUnknownOverwrite                 ErrorCode = 10009
+	ErrorCodeUnknownProvider                  ErrorCode = 10010
+	ErrorCodeUnknownRole                      ErrorCode = 10011
+	ErrorCodeUnknownToken                     ErrorCode = 10012
+	ErrorCodeUnknownUser                      ErrorCode = 10013
+	ErrorCodeUnknownEmoji                     ErrorCode = 10014
+	ErrorCodeUnknownWebhook                   ErrorCode = 10015
+	ErrorCodeBotsCannotUseEndpoint            ErrorCode = 20001
+	ErrorCodeOnlyBotsCanUseEndpoint           ErrorCode = 20002
+	ErrorCodeMaxGuilds                        ErrorCode = 30001
+	ErrorCodeMaxFriends                       ErrorCode = 30002
+	ErrorCodeMaxPins                          ErrorCode = 30003
+	ErrorCodeMaxGuildRoles                    ErrorCode = 30005
+	ErrorCodeMaxReactions                     ErrorCode = 30010
+	ErrorCodeMaxGuildChannels                 ErrorCode = 30013
+	ErrorCodeUnauthorized                     ErrorCode = 40001
+	ErrorCodeMissingAccess                    ErrorCode = 50001
+	ErrorCodeInvalidAccountType               ErrorCode = 50002
+	ErrorCodeCannotExecuteOnDM                ErrorCode = 50003
+	ErrorCodeEmbedDisabled                    ErrorCode = 50004
+	ErrorCodeCannotEditOtherUsersMessage      ErrorCode = 50005
+	ErrorCodeCannotSendEmptyMessage           ErrorCode = 50006
+	ErrorCodeCannotSendMessagesToUser         ErrorCode = 50007
+	ErrorCodeCannotSendMessagesInVoiceChannel ErrorCode = 50008
+	ErrorCodeChannelVerificationLevelTooHigh  ErrorCode = 50009
+	ErrorCodeOAuth2ApplicationNoBot           ErrorCode = 50010
+	ErrorCodeOAuth2ApplicationLimit           ErrorCode = 50011
+	ErrorCodeInvalidOAuthState                ErrorCode = 50012
+	ErrorCodeMissingPermissions               ErrorCode = 50013
+	ErrorCodeInvalidAuthenticationToken       ErrorCode = 50014
+	ErrorCodeNoteTooLong                      ErrorCode = 50015
+	ErrorCodeInvalidBulkDeleteCount           ErrorCode = 50016
+	ErrorCodeCannotPinInOtherChannel          ErrorCode = 50019
+	ErrorCodeInvalidInviteCode                ErrorCode = 50020
+	ErrorCodeCannotExecuteOnSystemMessage     ErrorCode = 50021
+	ErrorCodeInvalidOAuth2AccessToken         ErrorCode = 50025
+	ErrorCodeMessageTooOldToBulkDelete        ErrorCode = 50034
+	ErrorCodeInvalidFormBody                  ErrorCode = 50035
+	ErrorCodeInviteAcceptedToGuildWithoutBot  ErrorCode = 50036
+	ErrorCodeInvalidAPIVersion                ErrorCode = 50041
+	ErrorCodeReactionBlocked                  ErrorCode = 90001
+	ErrorCodeResourceOverloaded               ErrorCode = 130000
+)
+
+var errorCodeMessages = map[ErrorCode]string{
+	ErrorCodeGeneral:                          "general error",
+	ErrorCodeUnknownAccount:                   "unknown account",
+	ErrorCodeUnknownApplication:               "unknown application",
+	ErrorCodeUnknownChannel:                   "unknown channel",
+	ErrorCodeUnknownGuild:                     "unknown guild",
+	ErrorCodeUnknownIntegration:               "unknown integration",
+	ErrorCodeUnknownInvite:                    "unknown invite",
+	ErrorCodeUnknownMember:                    "unknown member",
+	ErrorCodeUnknownMessage:                   "unknown message",
+	ErrorCodeUnknownOverwrite:                 "unknown overwrite",
+	ErrorCodeUnknownProvider:                  "unknown provider",
+	ErrorCodeUnknownRole:                      "unknown role",
+	ErrorCodeUnknownToken:                     "unknown token",
+	ErrorCodeUnknownUser:                      "unknown user",
+	ErrorCodeUnknownEmoji:                     "unknown emoji",
+	ErrorCodeUnknownWebhook:                   "unknown webhook",
+	ErrorCodeBotsCannotUseEndpoint:            "bots cannot use this endpoint",
+	ErrorCodeOnlyBotsCanUseEndpoint:           "only bots can use this endpoint",
+	ErrorCodeMaxGuilds:                        "maximum number of guilds reached",
+	ErrorCodeMaxFriends:                       "maximum number of friends reached",
+	ErrorCodeMaxPins:                          "maximum number of pins reached",
+	ErrorCodeMaxGuildRoles:                    "maximum number of guild roles reached",
+	ErrorCodeMaxReactions:                     "maximum number of reactions reached",
+	ErrorCodeMaxGuildChannels:                 "maximum number of guild channels reached",
+	ErrorCodeUnauthorized:                     "unauthorized",
+	ErrorCodeMissingAccess:                    "missing access",
+	ErrorCodeInvalidAccountType:               "invalid account type",
+	ErrorCodeCannotExecuteOnDM:                "cannot execute action on a DM channel",
+	ErrorCodeEmbedDisabled:                    "embed disabled",
+	ErrorCodeCannotEditOtherUsersMessage:      "cannot edit a message authored by another user",
+	ErrorCodeCannotSendEmptyMessage:           "cannot send an empty message",
+	ErrorCodeCannotSendMessagesToUser:         "cannot send messages to this user",
+	ErrorCodeCannotSendMessagesInVoiceChannel: "cannot send messages in a voice channel",
+	ErrorCodeChannelVerificationLevelTooHigh:  "channel verification level is too high",
+	ErrorCodeOAuth2ApplicationNoBot:           "OAuth2 application does not have a bot",
+	ErrorCodeOAuth2ApplicationLimit:           "OAuth2 application limit reached",
+	ErrorCodeInvalidOAuthState:                "invalid OAuth state",
+	ErrorCodeMissingPermissions:               "missing permissions",
+	ErrorCodeInvalidAuthenticationToken:       "invalid authentication token",
+	ErrorCodeNoteTooLong:                      "note is too long",
+	ErrorCodeInvalidBulkDeleteCount:           "provided too few or too many messages to delete",
+	ErrorCodeCannotPinInOtherChannel:          "a message can only be pinned to the channel it was sent in",
+	ErrorCodeInvalidInviteCode:                "invite code is either invalid or taken",
+	ErrorCodeCannotExecuteOnSystemMessage:     "cannot execute action on a system message",
+	ErrorCodeInvalidOAuth2AccessToken:         "invalid OAuth2 access token",
+	ErrorCodeMessageTooOldToBulkDelete:        "a message provided was too old to bulk delete",
+	ErrorCodeInvalidFormBody:                  "invalid form body",
+	ErrorCodeInviteAcceptedToGuildWithoutBot:  "an invite was accepted to a guild the application's bot is not in",
+	ErrorCodeInvalidAPIVersion:                "invalid API version",
+	ErrorCodeReactionBlocked:                  "reaction blocked",
+	ErrorCodeResourceOverloaded:               "API resource is currently overloaded",
+}
+
+func (code ErrorCode) Error() string {
+	msg, ok := errorCodeMessages[code]
+	if !ok {
+		return fmt.Sprintf("discord error code %d", int(code))
+	}
+	return fmt.Sprintf("discord error code %d: %v", int(code), msg)
+}
+
+// FieldError is a validation error for a single field of a request body.
+type FieldError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// FieldErrors is the tree of validation errors Discord returns for an invalid request body.
+// The keys of Fields are field names or, for arrays, indexes.
+type FieldErrors struct {
+	Errors []*FieldError
+	Fields map[string]*FieldErrors
+}
+
+func (fe *FieldErrors) UnmarshalJSON(b []byte) error {
+	// Some routes only return the messages of each field.
+	var messages []string
+	err := json.Unmarshal(b, &messages)
+	if err == nil {
+		for _, m := range messages {
+			fe.Errors = append(fe.Errors, &FieldError{Message: m})
+		}
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return err
+	}
+	for k, v := range fields {
+		if k == "_errors" {
+			err = json.Unmarshal(v, &fe.Errors)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		child := new(FieldErrors)
+		err = json.Unmarshal(v, child)
+		if err != nil {
+			return err
+		}
+		if fe.Fields == nil {
+			fe.Fields = make(map[string]*FieldErrors)
+		}
+		fe.Fields[k] = child
+	}
+	return nil
+}
+
+// Flatten returns the errors of every field keyed by the path of the field, e.g. "roles.0.name".
+func (fe *FieldErrors) Flatten() map[string][]*FieldError {
+	m := make(map[string][]*FieldError)
+	fe.flatten("", m)
+	return m
+}
+
+func (fe *FieldErrors) flatten(path string, m map[string][]*FieldError) {
+	if len(fe.Errors) > 0 {
+		m[path] = append(m[path], fe.Errors...)
+	}
+	for k, child := range fe.Fields {
+		childPath := k
+		if path != "" {
+			childPath = path + "." + k
+		}
+		child.flatten(childPath, m)
+	}
+}
+
+func (fe *FieldErrors) String() string {
+	m := fe.Flatten()
+	paths := make([]string, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var lines []string
+	for _, path := range paths {
+		for _, err := range m[path] {
+			lines = append(lines, fmt.Sprintf("%v: %v", path, err.Message))
+		}
+	}
+	return strings.Join(lines, "; ")
+}
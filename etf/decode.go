@@ -0,0 +1,887 @@
+package etf
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Unmarshal decodes the term in b into v, which must be a non nil pointer.
+func Unmarshal(b []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("etf: Unmarshal needs a non nil pointer")
+	}
+	if len(b) == 0 || b[0] != Version {
+		return errors.New("etf: missing version")
+	}
+	d := &decoder{b: b, off: 1}
+	err := d.value(rv.Elem())
+	if err != nil {
+		return err
+	}
+	if d.off != len(b) {
+		return errors.New("etf: data after term")
+	}
+	return nil
+}
+
+// Valid reports whether b is a single encoded term.
+func Valid(b []byte) bool {
+	if len(b) == 0 || b[0] != Version {
+		return false
+	}
+	d := &decoder{b: b, off: 1}
+	return d.skip() == nil && d.off == len(b)
+}
+
+// ToJSON converts the term in b to JSON.
+// Integers too large for 32 bits become strings like snowflakes in Discord's JSON.
+func ToJSON(b []byte) ([]byte, error) {
+	var v interface{}
+	err := Unmarshal(b, &v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+var errUnexpectedEnd = errors.New("etf: unexpected end of term")
+
+type decoder struct {
+	b   []byte
+	off int
+}
+
+type UnmarshalTypeError struct {
+	Tag  byte
+	Type reflect.Type
+}
+
+func (err *UnmarshalTypeError) Error() string {
+	return fmt.Sprintf("etf: cannot unmarshal term with tag %d into %v", err.Tag, err.Type)
+}
+
+func (d *decoder) peek() (byte, error) {
+	if d.off >= len(d.b) {
+		return 0, errUnexpectedEnd
+	}
+	return d.b[d.off], nil
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if n < 0 || len(d.b)-d.off < n {
+		return nil, errUnexpectedEnd
+	}
+	b := d.b[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+func (d *decoder) readByte() (byte, error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *decoder) readUint16() (int, error) {
+	b, err := d.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint16(b)), nil
+}
+
+func (d *decoder) readUint32() (int, error) {
+	b, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	n := binary.BigEndian.Uint32(b)
+	if n > math.MaxInt32 {
+		return 0, errors.New("etf: length too large")
+	}
+	return int(n), nil
+}
+
+// readLen reads the element count of a list, tuple or map.
+// Every element occupies at least size bytes so counts that
+// cannot fit in the rest of the input are rejected before
+// anything is allocated for them.
+func (d *decoder) readLen(size int) (int, error) {
+	n, err := d.readUint32()
+	if err != nil {
+		return 0, err
+	}
+	if n > (len(d.b)-d.off)/size {
+		return 0, errUnexpectedEnd
+	}
+	return n, nil
+}
+
+func isAtom(tag byte) bool {
+	switch tag {
+	case tagAtom, tagSmallAtom, tagAtomUTF8, tagSmallAtomUTF8:
+		return true
+	}
+	return false
+}
+
+// atom reads the name of an atom, tag included.
+func (d *decoder) atom() ([]byte, error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	switch tag {
+	case tagAtom, tagAtomUTF8:
+		n, err = d.readUint16()
+	case tagSmallAtom, tagSmallAtomUTF8:
+		var nb byte
+		nb, err = d.readByte()
+		n = int(nb)
+	default:
+		return nil, errors.New("etf: expected atom")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.read(n)
+}
+
+// isNil reports whether the next term is the nil atom and consumes it if so.
+func (d *decoder) isNil() (bool, error) {
+	tag, err := d.peek()
+	if err != nil || !isAtom(tag) {
+		return false, err
+	}
+	off := d.off
+	name, err := d.atom()
+	if err != nil {
+		return false, err
+	}
+	if string(name) == "nil" {
+		return true, nil
+	}
+	d.off = off
+	return false, nil
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+func (d *decoder) value(v reflect.Value) error {
+	isNil, err := d.isNil()
+	if err != nil {
+		return err
+	}
+	if isNil {
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.value(v.Elem())
+	}
+
+	switch {
+	case v.Type() == rawTermType:
+		start := d.off
+		err := d.skip()
+		if err != nil {
+			return err
+		}
+		raw := make(RawTerm, 0, 1+d.off-start)
+		raw = append(raw, Version)
+		v.SetBytes(append(raw, d.b[start:d.off]...))
+		return nil
+	case v.Type() == timeType:
+		// Faster than through JSON.
+		s, err := d.string()
+		if err != nil {
+			return err
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case v.CanAddr() && v.Addr().Type().Implements(jsonUnmarshalerType):
+		b, err := d.json()
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(b)
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			break
+		}
+		x, err := d.generic()
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	case reflect.Struct:
+		return d.structValue(v)
+	case reflect.Map:
+		return d.mapValue(v)
+	case reflect.Slice:
+		return d.sliceValue(v)
+	case reflect.Array:
+		return d.arrayValue(v)
+	case reflect.String:
+		s, err := d.string()
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+		return nil
+	case reflect.Bool:
+		name, err := d.atom()
+		if err != nil {
+			return err
+		}
+		switch string(name) {
+		case "true":
+			v.SetBool(true)
+		case "false":
+			v.SetBool(false)
+		default:
+			return fmt.Errorf("etf: cannot unmarshal atom %q into bool", name)
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := d.int64()
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("etf: %v overflows %v", i, v.Type())
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := d.uint64()
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("etf: %v overflows %v", u, v.Type())
+		}
+		v.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := d.float64()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	}
+
+	tag, _ := d.peek()
+	return &UnmarshalTypeError{Tag: tag, Type: v.Type()}
+}
+
+// key reads a map key, which Discord sends as an atom.
+func (d *decoder) key() (string, error) {
+	return d.string()
+}
+
+// keyBytes is like key but does not allocate for atoms and binaries.
+func (d *decoder) keyBytes() ([]byte, error) {
+	tag, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case tagAtom, tagSmallAtom, tagAtomUTF8, tagSmallAtomUTF8:
+		return d.atom()
+	case tagBinary, tagString:
+		return d.bytes()
+	}
+	s, err := d.string()
+	return []byte(s), err
+}
+
+func (d *decoder) mapArity() (int, error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	if tag != tagMap {
+		d.off--
+		return 0, errors.New("etf: expected map")
+	}
+	// A key and a value.
+	return d.readLen(2)
+}
+
+func (d *decoder) structValue(v reflect.Value) error {
+	tag, err := d.peek()
+	if err != nil {
+		return err
+	}
+	if tag != tagMap {
+		return &UnmarshalTypeError{Tag: tag, Type: v.Type()}
+	}
+	n, err := d.mapArity()
+	if err != nil {
+		return err
+	}
+	si := structFields(v.Type())
+	for i := 0; i < n; i++ {
+		k, err := d.keyBytes()
+		if err != nil {
+			return err
+		}
+		f := si.field(k)
+		if f == nil {
+			err = d.skip()
+		} else {
+			err = d.value(fieldByIndex(v, f.index))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but allocates nil embedded pointers.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func (d *decoder) mapValue(v reflect.Value) error {
+	t := v.Type()
+	if t.Key().Kind() != reflect.String {
+		return fmt.Errorf("etf: cannot unmarshal into %v, keys must be strings", t)
+	}
+	n, err := d.mapArity()
+	if err != nil {
+		return err
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, n))
+	}
+	for i := 0; i < n; i++ {
+		k, err := d.key()
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		err = d.value(elem)
+		if err != nil {
+			return err
+		}
+		v.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), elem)
+	}
+	return nil
+}
+
+// listLen reads the header of a list or tuple.
+// hasTail reports whether the elements are followed by a tail.
+func (d *decoder) listLen() (n int, hasTail bool, err error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch tag {
+	case tagNil:
+		return 0, false, nil
+	case tagList:
+		n, err = d.readLen(1)
+		return n, true, err
+	case tagSmallTuple:
+		var nb byte
+		nb, err = d.readByte()
+		return int(nb), false, err
+	case tagLargeTuple:
+		n, err = d.readLen(1)
+		return n, false, err
+	}
+	d.off--
+	return 0, false, errors.New("etf: expected list")
+}
+
+func (d *decoder) sliceValue(v reflect.Value) error {
+	tag, err := d.peek()
+	if err != nil {
+		return err
+	}
+	t := v.Type()
+	if tag == tagBinary || tag == tagString {
+		if t.Elem().Kind() == reflect.Uint8 {
+			b, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		if tag == tagString {
+			// A list of small integers.
+			b, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			s := reflect.MakeSlice(t, len(b), len(b))
+			for i, c := range b {
+				err = setSmallInt(s.Index(i), c)
+				if err != nil {
+					return err
+				}
+			}
+			v.Set(s)
+			return nil
+		}
+	}
+
+	n, hasTail, err := d.listLen()
+	if err == errUnexpectedEnd {
+		return err
+	}
+	if err != nil {
+		return &UnmarshalTypeError{Tag: tag, Type: t}
+	}
+	s := reflect.MakeSlice(t, n, n)
+	for i := 0; i < n; i++ {
+		err = d.value(s.Index(i))
+		if err != nil {
+			return err
+		}
+	}
+	v.Set(s)
+	if hasTail {
+		return d.skip()
+	}
+	return nil
+}
+
+func setSmallInt(v reflect.Value, c byte) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(c))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(uint64(c))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(c))
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(int64(c)))
+	default:
+		return &UnmarshalTypeError{Tag: tagString, Type: v.Type()}
+	}
+	return nil
+}
+
+func (d *decoder) arrayValue(v reflect.Value) error {
+	tag, err := d.peek()
+	if err != nil {
+		return err
+	}
+	t := v.Type()
+	if tag == tagBinary || tag == tagString {
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			var c byte
+			if i < len(b) {
+				c = b[i]
+			}
+			err = setSmallInt(v.Index(i), c)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	n, hasTail, err := d.listLen()
+	if err == errUnexpectedEnd {
+		return err
+	}
+	if err != nil {
+		return &UnmarshalTypeError{Tag: tag, Type: t}
+	}
+	for i := 0; i < n; i++ {
+		if i < v.Len() {
+			err = d.value(v.Index(i))
+		} else {
+			err = d.skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for i := n; i < v.Len(); i++ {
+		v.Index(i).Set(reflect.Zero(t.Elem()))
+	}
+	if hasTail {
+		return d.skip()
+	}
+	return nil
+}
+
+// bytes reads a binary or a string.
+func (d *decoder) bytes() ([]byte, error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	switch tag {
+	case tagBinary:
+		n, err = d.readUint32()
+	case tagString:
+		n, err = d.readUint16()
+	default:
+		d.off--
+		return nil, errors.New("etf: expected binary")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.read(n)
+}
+
+// string reads a binary, string, atom or integer as a string.
+func (d *decoder) string() (string, error) {
+	tag, err := d.peek()
+	if err != nil {
+		return "", err
+	}
+	switch tag {
+	case tagBinary, tagString:
+		b, err := d.bytes()
+		return string(b), err
+	case tagAtom, tagSmallAtom, tagAtomUTF8, tagSmallAtomUTF8:
+		b, err := d.atom()
+		return string(b), err
+	case tagSmallInteger, tagInteger, tagSmallBig, tagLargeBig:
+		i, err := d.bigInt()
+		if err != nil {
+			return "", err
+		}
+		return i.String(), nil
+	}
+	return "", &UnmarshalTypeError{Tag: tag, Type: reflect.TypeOf("")}
+}
+
+// integer reads an integer that fits in 64 bits.
+func (d *decoder) integer() (neg bool, mag uint64, err error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return false, 0, err
+	}
+	switch tag {
+	case tagSmallInteger:
+		c, err := d.readByte()
+		return false, uint64(c), err
+	case tagInteger:
+		b, err := d.read(4)
+		if err != nil {
+			return false, 0, err
+		}
+		i := int32(binary.BigEndian.Uint32(b))
+		if i < 0 {
+			return true, uint64(-int64(i)), nil
+		}
+		return false, uint64(i), nil
+	case tagSmallBig, tagLargeBig:
+		d.off--
+		n, sign, digits, err := d.big()
+		if err != nil {
+			return false, 0, err
+		}
+		if n > 8 {
+			return false, 0, errors.New("etf: integer overflows 64 bits")
+		}
+		for i := n - 1; i >= 0; i-- {
+			mag = mag<<8 | uint64(digits[i])
+		}
+		return sign != 0, mag, nil
+	}
+	d.off--
+	return false, 0, errors.New("etf: expected integer")
+}
+
+// big reads the parts of a big integer. The digits are little endian.
+func (d *decoder) big() (n int, sign byte, digits []byte, err error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if tag == tagSmallBig {
+		var nb byte
+		nb, err = d.readByte()
+		n = int(nb)
+	} else {
+		n, err = d.readUint32()
+	}
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	sign, err = d.readByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	digits, err = d.read(n)
+	return n, sign, digits, err
+}
+
+func (d *decoder) bigInt() (*big.Int, error) {
+	tag, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+	if tag != tagSmallBig && tag != tagLargeBig {
+		neg, mag, err := d.integer()
+		if err != nil {
+			return nil, err
+		}
+		i := new(big.Int).SetUint64(mag)
+		if neg {
+			i.Neg(i)
+		}
+		return i, nil
+	}
+	n, sign, digits, err := d.big()
+	if err != nil {
+		return nil, err
+	}
+	be := make([]byte, n)
+	for i, c := range digits {
+		be[n-1-i] = c
+	}
+	i := new(big.Int).SetBytes(be)
+	if sign != 0 {
+		i.Neg(i)
+	}
+	return i, nil
+}
+
+func (d *decoder) int64() (int64, error) {
+	neg, mag, err := d.integer()
+	if err != nil {
+		return 0, err
+	}
+	if neg {
+		if mag > 1<<63 {
+			return 0, errors.New("etf: integer overflows int64")
+		}
+		return -int64(mag), nil
+	}
+	if mag > math.MaxInt64 {
+		return 0, errors.New("etf: integer overflows int64")
+	}
+	return int64(mag), nil
+}
+
+func (d *decoder) uint64() (uint64, error) {
+	neg, mag, err := d.integer()
+	if err != nil {
+		return 0, err
+	}
+	if neg && mag != 0 {
+		return 0, errors.New("etf: negative integer into unsigned")
+	}
+	return mag, nil
+}
+
+func (d *decoder) float64() (float64, error) {
+	tag, err := d.peek()
+	if err != nil {
+		return 0, err
+	}
+	switch tag {
+	case tagNewFloat:
+		d.off++
+		b, err := d.read(8)
+		if err != nil {
+			return 0, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case tagFloat:
+		d.off++
+		b, err := d.read(31)
+		if err != nil {
+			return 0, err
+		}
+		end := 0
+		for end < len(b) && b[end] != 0 {
+			end++
+		}
+		return strconv.ParseFloat(string(b[:end]), 64)
+	}
+	i, err := d.int64()
+	return float64(i), err
+}
+
+// generic decodes a term into the types encoding/json would use for interface{},
+// except that integers are int64, or strings if they do not fit in 32 bits.
+func (d *decoder) generic() (interface{}, error) {
+	tag, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case tagAtom, tagSmallAtom, tagAtomUTF8, tagSmallAtomUTF8:
+		name, err := d.atom()
+		if err != nil {
+			return nil, err
+		}
+		switch string(name) {
+		case "nil":
+			return nil, nil
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return string(name), nil
+	case tagSmallInteger, tagInteger:
+		return d.int64()
+	case tagSmallBig, tagLargeBig:
+		i, err := d.bigInt()
+		if err != nil {
+			return nil, err
+		}
+		return i.String(), nil
+	case tagNewFloat, tagFloat:
+		return d.float64()
+	case tagBinary:
+		b, err := d.bytes()
+		return string(b), err
+	case tagString:
+		b, err := d.bytes()
+		if err != nil {
+			return nil, err
+		}
+		l := make([]interface{}, len(b))
+		for i, c := range b {
+			l[i] = int64(c)
+		}
+		return l, nil
+	case tagNil, tagList, tagSmallTuple, tagLargeTuple:
+		n, hasTail, err := d.listLen()
+		if err != nil {
+			return nil, err
+		}
+		l := make([]interface{}, n)
+		for i := range l {
+			l[i], err = d.generic()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if hasTail {
+			err = d.skip()
+		}
+		return l, err
+	case tagMap:
+		n, err := d.mapArity()
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := d.key()
+			if err != nil {
+				return nil, err
+			}
+			m[k], err = d.generic()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("etf: unsupported tag %d", tag)
+}
+
+// json converts the next term to JSON.
+func (d *decoder) json() ([]byte, error) {
+	v, err := d.generic()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// skip skips the next term.
+func (d *decoder) skip() error {
+	tag, err := d.peek()
+	if err != nil {
+		return err
+	}
+	switch tag {
+	case tagAtom, tagSmallAtom, tagAtomUTF8, tagSmallAtomUTF8:
+		_, err = d.atom()
+	case tagSmallInteger, tagInteger:
+		_, _, err = d.integer()
+	case tagSmallBig, tagLargeBig:
+		_, _, _, err = d.big()
+	case tagNewFloat, tagFloat:
+		_, err = d.float64()
+	case tagBinary, tagString:
+		_, err = d.bytes()
+	case tagNil, tagList, tagSmallTuple, tagLargeTuple:
+		var n int
+		var hasTail bool
+		n, hasTail, err = d.listLen()
+		if hasTail {
+			n++
+		}
+		for i := 0; i < n && err == nil; i++ {
+			err = d.skip()
+		}
+	case tagMap:
+		var n int
+		n, err = d.mapArity()
+		for i := 0; i < 2*n && err == nil; i++ {
+			err = d.skip()
+		}
+	default:
+		err = fmt.Errorf("etf: unsupported tag %d", tag)
+	}
+	return err
+}
@@ -0,0 +1,286 @@
+package etf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Marshal encodes v. Strings are encoded as binaries and map keys and struct fields as
+// binaries too, which Discord accepts.
+func Marshal(v interface{}) ([]byte, error) {
+	e := &encoder{b: []byte{Version}}
+	err := e.value(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return e.b, nil
+}
+
+type encoder struct {
+	b []byte
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonNumberType    = reflect.TypeOf(json.Number(""))
+)
+
+func (e *encoder) atom(name string) {
+	e.b = append(e.b, tagAtom, 0, byte(len(name)))
+	e.b = append(e.b, name...)
+}
+
+func (e *encoder) binary(b []byte) {
+	e.b = append(e.b, tagBinary, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(e.b[len(e.b)-4:], uint32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+func (e *encoder) string(s string) {
+	e.b = append(e.b, tagBinary, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(e.b[len(e.b)-4:], uint32(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) header(tag byte, n int) {
+	e.b = append(e.b, tag, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(e.b[len(e.b)-4:], uint32(n))
+}
+
+func (e *encoder) int64(i int64) {
+	switch {
+	case i >= 0 && i <= math.MaxUint8:
+		e.b = append(e.b, tagSmallInteger, byte(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		e.b = append(e.b, tagInteger, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.b[len(e.b)-4:], uint32(i))
+	case i < 0:
+		e.big(true, uint64(-i))
+	default:
+		e.big(false, uint64(i))
+	}
+}
+
+func (e *encoder) uint64(u uint64) {
+	if u <= math.MaxInt32 {
+		e.int64(int64(u))
+		return
+	}
+	e.big(false, u)
+}
+
+func (e *encoder) big(neg bool, mag uint64) {
+	var digits []byte
+	for ; mag > 0; mag >>= 8 {
+		digits = append(digits, byte(mag))
+	}
+	var sign byte
+	if neg {
+		sign = 1
+	}
+	e.b = append(e.b, tagSmallBig, byte(len(digits)), sign)
+	e.b = append(e.b, digits...)
+}
+
+func (e *encoder) float64(f float64) {
+	e.b = append(e.b, tagNewFloat, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(e.b[len(e.b)-8:], math.Float64bits(f))
+}
+
+func (e *encoder) value(v reflect.Value) error {
+	if !v.IsValid() {
+		e.atom("nil")
+		return nil
+	}
+
+	switch v.Type() {
+	case rawTermType:
+		raw := v.Bytes()
+		if len(raw) == 0 || raw[0] != Version {
+			return fmt.Errorf("etf: invalid RawTerm")
+		}
+		e.b = append(e.b, raw[1:]...)
+		return nil
+	case timeType:
+		e.string(v.Interface().(time.Time).Format(time.RFC3339Nano))
+		return nil
+	case jsonNumberType:
+		n := v.Interface().(json.Number)
+		if i, err := n.Int64(); err == nil {
+			e.int64(i)
+			return nil
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return err
+		}
+		e.float64(f)
+		return nil
+	}
+	if v.Type().Implements(jsonMarshalerType) && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		return e.json(v.Interface().(json.Marshaler))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.atom("nil")
+			return nil
+		}
+		return e.value(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.atom("true")
+		} else {
+			e.atom("false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uint64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.float64(v.Float())
+	case reflect.String:
+		e.string(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.atom("nil")
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.binary(v.Bytes())
+			return nil
+		}
+		return e.list(v)
+	case reflect.Array:
+		return e.list(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.atom("nil")
+			return nil
+		}
+		return e.mapValue(v)
+	case reflect.Struct:
+		return e.structValue(v)
+	default:
+		return fmt.Errorf("etf: cannot marshal %v", v.Type())
+	}
+	return nil
+}
+
+func (e *encoder) list(v reflect.Value) error {
+	if v.Len() == 0 {
+		e.b = append(e.b, tagNil)
+		return nil
+	}
+	e.header(tagList, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		err := e.value(v.Index(i))
+		if err != nil {
+			return err
+		}
+	}
+	e.b = append(e.b, tagNil)
+	return nil
+}
+
+func (e *encoder) mapValue(v reflect.Value) error {
+	if v.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("etf: cannot marshal %v, keys must be strings", v.Type())
+	}
+	keys := v.MapKeys()
+	// Deterministic like encoding/json.
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	e.header(tagMap, len(keys))
+	for _, k := range keys {
+		e.string(k.String())
+		err := e.value(v.MapIndex(k))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) structValue(v reflect.Value) error {
+	si := structFields(v.Type())
+	type kv struct {
+		name string
+		v    reflect.Value
+	}
+	fields := make([]kv, 0, len(si.fields))
+	for _, f := range si.fields {
+		fv, ok := fieldByIndexNoAlloc(v, f.index)
+		if !ok || f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		fields = append(fields, kv{f.name, fv})
+	}
+	e.header(tagMap, len(fields))
+	for _, f := range fields {
+		e.string(f.name)
+		err := e.value(f.v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndexNoAlloc is like reflect.Value.FieldByIndex but returns false
+// if an embedded pointer is nil.
+func fieldByIndexNoAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// isEmptyValue is from encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// json encodes m through JSON.
+func (e *encoder) json(m json.Marshaler) error {
+	b, err := m.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	err = d.Decode(&v)
+	if err != nil {
+		return err
+	}
+	return e.value(reflect.ValueOf(v))
+}
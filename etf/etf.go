@@ -0,0 +1,145 @@
+// Package etf implements the subset of the Erlang external term format used by the Discord gateway.
+// Go values are mapped like encoding/json maps them to JSON, including json struct tags,
+// so that the same structs can be used with both encodings.
+//
+// Terms map to Go values like this:
+//
+//	nil atom          nil, or leaves the value unchanged
+//	true, false atoms bool
+//	other atoms       string
+//	integers          any number, or string because Discord sends snowflakes as integers
+//	floats            float32, float64
+//	binaries, strings string, []byte
+//	lists, tuples     slices and arrays
+//	maps              structs and maps with string keys
+//
+// Types implementing json.Unmarshaler or json.Marshaler go through JSON.
+package etf
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Version starts every encoded term.
+const Version = 131
+
+// Term tags.
+const (
+	tagNewFloat      = 70
+	tagSmallInteger  = 97
+	tagInteger       = 98
+	tagFloat         = 99
+	tagAtom          = 100
+	tagSmallTuple    = 104
+	tagLargeTuple    = 105
+	tagNil           = 106
+	tagString        = 107
+	tagList          = 108
+	tagBinary        = 109
+	tagSmallBig      = 110
+	tagLargeBig      = 111
+	tagSmallAtom     = 115
+	tagMap           = 116
+	tagAtomUTF8      = 118
+	tagSmallAtomUTF8 = 119
+)
+
+// RawTerm is an encoded term, including the version.
+// It can be used to delay decoding or to encode a term as is.
+type RawTerm []byte
+
+var rawTermType = reflect.TypeOf(RawTerm(nil))
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+type structInfo struct {
+	fields []field
+	byName map[string]*field
+}
+
+// structCache maps a struct type to its *structInfo.
+var structCache sync.Map
+
+// structFields returns the fields of a struct type the same way encoding/json sees them.
+// Fields of embedded structs are promoted unless a shallower field has the same name.
+func structFields(t reflect.Type) *structInfo {
+	if si, ok := structCache.Load(t); ok {
+		return si.(*structInfo)
+	}
+	si := &structInfo{byName: make(map[string]*field)}
+	appendFields(&si.fields, make(map[string]bool), t, nil)
+	for i := range si.fields {
+		si.byName[si.fields[i].name] = &si.fields[i]
+	}
+	structCache.Store(t, si)
+	return si
+}
+
+// field returns the field for key, preferring an exact match
+// but falling back to a case insensitive one like encoding/json.
+func (si *structInfo) field(key []byte) *field {
+	if f := si.byName[string(key)]; f != nil {
+		return f
+	}
+	for i := range si.fields {
+		if bytes.EqualFold([]byte(si.fields[i].name), key) {
+			return &si.fields[i]
+		}
+	}
+	return nil
+}
+
+func appendFields(fields *[]field, seen map[string]bool, t reflect.Type, index []int) {
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, sf)
+			continue
+		}
+		if sf.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		*fields = append(*fields, field{
+			name:      name,
+			index:     append(append([]int(nil), index...), i),
+			omitEmpty: strings.Contains(opts, ",omitempty"),
+		})
+	}
+	// After the fields of t as they take precedence.
+	for _, sf := range embedded {
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		appendFields(fields, seen, ft, append(append([]int(nil), index...), sf.Index...))
+	}
+}
@@ -0,0 +1,235 @@
+package etf
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type user struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Bot      bool   `json:"bot"`
+}
+
+type member struct {
+	User     *user     `json:"user"`
+	Nick     *string   `json:"nick"`
+	Roles    []string  `json:"roles"`
+	JoinedAt time.Time `json:"joined_at"`
+	Ignored  int       `json:"-"`
+}
+
+type memberAdd struct {
+	member
+	GuildID string `json:"guild_id"`
+	Flags   uint8  `json:"flags,omitempty"`
+}
+
+// term builds terms like Discord sends them, with atom keys and integer snowflakes.
+type term []byte
+
+func (t term) atom(name string) term {
+	t = append(t, tagSmallAtomUTF8, byte(len(name)))
+	return append(t, name...)
+}
+
+func (t term) binary(s string) term {
+	t = append(t, tagBinary, 0, 0, 0, byte(len(s)))
+	return append(t, s...)
+}
+
+func (t term) snowflake(digits ...byte) term {
+	t = append(t, tagSmallBig, byte(len(digits)), 0)
+	return append(t, digits...)
+}
+
+func (t term) append(b ...byte) term {
+	return append(t, b...)
+}
+
+func (t term) mapHeader(n int) term {
+	return append(t, tagMap, 0, 0, 0, byte(n))
+}
+
+func (t term) listHeader(n int) term {
+	return append(t, tagList, 0, 0, 0, byte(n))
+}
+
+func TestUnmarshal(t *testing.T) {
+	b := term{Version}.mapHeader(6).
+		atom("user").mapHeader(3).
+		atom("id").snowflake(0x00, 0x00, 0x00, 0x00, 0x01). // 4294967296
+		atom("username").binary("discgo").
+		atom("bot").atom("true").
+		atom("nick").atom("nil").
+		atom("roles").listHeader(2).snowflake(0x01, 0x00, 0x00, 0x00, 0x01).binary("2").append(tagNil).
+		atom("joined_at").binary("2017-01-02T03:04:05.123456+00:00").
+		atom("guild_id").append(tagSmallInteger, 7).
+		atom("unknown").mapHeader(1).atom("a").listHeader(1).append(tagNewFloat, 0, 0, 0, 0, 0, 0, 0, 0).append(tagNil)
+
+	var e memberAdd
+	e.Ignored = 5
+	err := Unmarshal(b, &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := memberAdd{
+		member: member{
+			User: &user{
+				ID:       "4294967296",
+				Username: "discgo",
+				Bot:      true,
+			},
+			Roles:    []string{"4294967297", "2"},
+			JoinedAt: time.Date(2017, 1, 2, 3, 4, 5, 123456000, time.UTC),
+			Ignored:  5,
+		},
+		GuildID: "7",
+	}
+	if !e.JoinedAt.Equal(expected.JoinedAt) {
+		t.Fatalf("expected %v but got %v", expected.JoinedAt, e.JoinedAt)
+	}
+	e.JoinedAt = expected.JoinedAt
+	if !reflect.DeepEqual(e, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, e)
+	}
+}
+
+func TestUnmarshal_Generic(t *testing.T) {
+	b := term{Version}.mapHeader(4).
+		atom("id").snowflake(0x00, 0x00, 0x00, 0x00, 0x01).
+		atom("n").append(tagInteger, 0xFF, 0xFF, 0xFF, 0xFE).
+		atom("l").append(tagString, 0, 2, 1, 2).
+		atom("s").binary("x")
+	j, err := ToJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"id":"4294967296","l":[1,2],"n":-2,"s":"x"}`
+	if string(j) != expected {
+		t.Fatalf("expected %s but got %s", expected, j)
+	}
+
+	var raw struct {
+		ID json.RawMessage `json:"id"`
+		L  RawTerm         `json:"l"`
+	}
+	err = Unmarshal(b, &raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw.ID) != `"4294967296"` {
+		t.Fatalf("expected %s but got %s", `"4294967296"`, raw.ID)
+	}
+	var l []int
+	err = Unmarshal(raw.L, &l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(l, []int{1, 2}) {
+		t.Fatalf("expected %v but got %v", []int{1, 2}, l)
+	}
+}
+
+func TestUnmarshal_Length(t *testing.T) {
+	err := Unmarshal([]byte{Version, tagList, 0x7F, 0xFF, 0xFF, 0xFF}, &[]int{})
+	if err != errUnexpectedEnd {
+		t.Fatalf("expected %v but got %v", errUnexpectedEnd, err)
+	}
+
+	inputs := [][]byte{
+		{Version, tagList, 0x7F, 0xFF, 0xFF, 0xFF},
+		{Version, tagLargeTuple, 0x7F, 0xFF, 0xFF, 0xFF},
+		{Version, tagMap, 0x00, 0x00, 0x00, 0x01, tagNil},
+	}
+	for _, b := range inputs {
+		var v interface{}
+		err = Unmarshal(b, &v)
+		if err != errUnexpectedEnd {
+			t.Fatalf("expected %v but got %v", errUnexpectedEnd, err)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	nick := "nick"
+	v := memberAdd{
+		member: member{
+			User:     &user{ID: "1", Username: "discgo"},
+			Nick:     &nick,
+			Roles:    []string{},
+			JoinedAt: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		GuildID: "2",
+	}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Valid(b) {
+		t.Fatal("expected valid term")
+	}
+	var v2 memberAdd
+	err = Unmarshal(b, &v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, v2) {
+		t.Fatalf("expected %+v but got %+v", v, v2)
+	}
+
+	// Omitted fields.
+	var m map[string]interface{}
+	err = Unmarshal(b, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["flags"]; ok {
+		t.Fatal("expected flags to be omitted")
+	}
+	if _, ok := m["Ignored"]; ok {
+		t.Fatal("expected Ignored to be omitted")
+	}
+}
+
+func TestMarshal_Numbers(t *testing.T) {
+	for _, i := range []int64{0, 255, 256, -1, 1 << 31, -1 << 40, 1<<63 - 1} {
+		b, err := Marshal(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var i2 int64
+		err = Unmarshal(b, &i2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i != i2 {
+			t.Fatalf("expected %v but got %v", i, i2)
+		}
+	}
+
+	b, err := Marshal(1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f float64
+	err = Unmarshal(b, &f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f != 1.5 {
+		t.Fatalf("expected %v but got %v", 1.5, f)
+	}
+
+	var u uint8
+	b, err = Marshal(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Unmarshal(b, &u)
+	if err == nil {
+		t.Fatal("expected overflow error")
+	}
+}
@@ -2,7 +2,6 @@ package discgo
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 )
 
@@ -96,6 +95,11 @@ type EventGuildMemberUpdate struct {
 type EventGuildMembersChunk struct {
 	GuildID string              `json:"guild_id"`
 	Members []*ModelGuildMember `json:"members"`
+	// Only sent by newer API versions.
+	ChunkIndex int      `json:"chunk_index"`
+	ChunkCount int      `json:"chunk_count"`
+	NotFound   []string `json:"not_found"`
+	Nonce      string   `json:"nonce"`
 }
 
 type EventGuildRoleCreate struct {
@@ -193,7 +197,7 @@ type EventVoiceStateUpdate struct {
 	ModelVoiceState
 }
 
-type eventVoiceServerUpdate struct {
+type EventVoiceServerUpdate struct {
 	Token    string `json:"token"`
 	GuildID  string `json:"guild_id"`
 	Endpoint string `json:"endpoint"`
@@ -210,75 +214,90 @@ func (e *EventHandlerError) Error() string {
 	if err != nil {
 		panic(err)
 	}
-	return fmt.Sprintf("%v handler error: %v\nevent: %v", e.EventName, e.Err, eventJSON)
+	return fmt.Sprintf("%v handler error: %v\nevent: %s", e.EventName, e.Err, eventJSON)
 }
 
-var errUnknownEvent = errors.New("unknown event")
+// EventDecodeError is reported when a dispatched event cannot be decoded.
+type EventDecodeError struct {
+	Err       error
+	Raw       json.RawMessage
+	EventName string
+}
+
+func (e *EventDecodeError) Error() string {
+	return fmt.Sprintf("failed to decode %v: %v\nevent: %s", e.EventName, e.Err, e.Raw)
+}
+
+// EventUnknown is an event discgo does not know about yet.
+type EventUnknown struct {
+	Type string
+	Raw  json.RawMessage
+}
 
-func getEventStruct(eventType string) (interface{}, error) {
+func getEventStruct(eventType string) interface{} {
 	switch eventType {
 	case "READY":
-		return new(EventReady), nil
+		return new(EventReady)
 	case "RESUMED":
-		return new(eventResumed), nil
+		return new(eventResumed)
 	case "CHANNEL_CREATE":
-		return new(EventChannelCreate), nil
+		return new(EventChannelCreate)
 	case "CHANNEL_UPDATE":
-		return new(EventChannelUpdate), nil
+		return new(EventChannelUpdate)
 	case "CHANNEL_DELETE":
-		return new(EventChannelDelete), nil
+		return new(EventChannelDelete)
 	case "GUILD_CREATE":
-		return new(EventGuildCreate), nil
+		return new(EventGuildCreate)
 	case "GUILD_UPDATE":
-		return new(EventGuildUpdate), nil
+		return new(EventGuildUpdate)
 	case "GUILD_DELETE":
-		return new(EventGuildDelete), nil
+		return new(EventGuildDelete)
 	case "GUILD_BAN_ADD":
-		return new(EventGuildBanAdd), nil
+		return new(EventGuildBanAdd)
 	case "GUILD_BAN_REMOVE":
-		return new(EventGuildBanRemove), nil
+		return new(EventGuildBanRemove)
 	case "GUILD_EMOJIS_UPDATE":
-		return new(EventGuildEmojisUpdate), nil
+		return new(EventGuildEmojisUpdate)
 	case "GUILD_INTEGRATIONS_UPDATE":
-		return new(EventGuildIntegrationsUpdate), nil
+		return new(EventGuildIntegrationsUpdate)
 	case "GUILD_MEMBER_ADD":
-		return new(EventGuildMemberAdd), nil
+		return new(EventGuildMemberAdd)
 	case "GUILD_MEMBER_REMOVE":
-		return new(EventGuildMemberRemove), nil
+		return new(EventGuildMemberRemove)
 	case "GUILD_MEMBER_UPDATE":
-		return new(EventGuildMemberUpdate), nil
+		return new(EventGuildMemberUpdate)
 	case "GUILD_MEMBERS_CHUNK":
-		return new(EventGuildMembersChunk), nil
+		return new(EventGuildMembersChunk)
 	case "GUILD_ROLE_CREATE":
-		return new(EventGuildRoleCreate), nil
+		return new(EventGuildRoleCreate)
 	case "GUILD_ROLE_UPDATE":
-		return new(EventGuildRoleUpdate), nil
+		return new(EventGuildRoleUpdate)
 	case "GUILD_ROLE_DELETE":
-		return new(EventGuildRoleDelete), nil
+		return new(EventGuildRoleDelete)
 	case "MESSAGE_CREATE":
-		return new(EventMessageCreate), nil
+		return new(EventMessageCreate)
 	case "MESSAGE_UPDATE":
-		return new(EventMessageUpdate), nil
+		return new(EventMessageUpdate)
 	case "MESSAGE_DELETE":
-		return new(EventMessageDelete), nil
+		return new(EventMessageDelete)
 	case "MESSAGE_DELETE_BULK":
-		return new(EventMessageDeleteBulk), nil
+		return new(EventMessageDeleteBulk)
 	case "MESSAGE_REACTION_ADD":
-		return new(EventMessageReactionAdd), nil
+		return new(EventMessageReactionAdd)
 	case "MESSAGE_REACTION_REMOVE":
-		return new(EventMessageReactionRemove), nil
+		return new(EventMessageReactionRemove)
 	case "MESSAGE_REACTION_REMOVE_ALL":
-		return new(EventMessageReactionRemoveAll), nil
+		return new(EventMessageReactionRemoveAll)
 	case "PRESENCE_UPDATE":
-		return new(EventPresenceUpdate), nil
+		return new(EventPresenceUpdate)
 	case "TYPING_START":
-		return new(EventTypingStart), nil
+		return new(EventTypingStart)
 	case "USER_UPDATE":
-		return new(EventUserUpdate), nil
+		return new(EventUserUpdate)
 	case "VOICE_STATE_UPDATE":
-		return new(EventVoiceStateUpdate), nil
+		return new(EventVoiceStateUpdate)
 	case "VOICE_SERVER_UPDATE":
-		return new(eventVoiceServerUpdate), nil
+		return new(EventVoiceServerUpdate)
 	}
-	return nil, errUnknownEvent
+	return &EventUnknown{Type: eventType}
 }
@@ -0,0 +1,448 @@
+package discgo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventMux is an EventHandler that routes events to handlers registered for their type.
+// Handlers of an event run in the order they were registered, followed by those registered
+// with OnEvent. The first error, including ErrEventDone, stops the event from being handled further.
+// The zero value is ready to use.
+type EventMux struct {
+	mu sync.RWMutex
+	// Slices are replaced instead of modified so Handle can use them without holding mu.
+	handlers   map[reflect.Type][]*muxHandler
+	all        []*muxHandler
+	middleware []EventMiddleware
+	chain      EventHandlerFunc
+}
+
+type muxHandler struct {
+	fn EventHandlerFunc
+}
+
+// EventMiddleware wraps the handling of every event by an EventMux.
+// It may skip next to filter events.
+type EventMiddleware func(next EventHandlerFunc) EventHandlerFunc
+
+// Use adds middleware. The first middleware added is the outermost.
+func (m *EventMux) Use(mw ...EventMiddleware) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.middleware = append(m.middleware[:len(m.middleware):len(m.middleware)], mw...)
+	m.chain = nil
+}
+
+// Handle implements EventHandler.
+func (m *EventMux) Handle(ctx context.Context, e interface{}) error {
+	m.mu.RLock()
+	chain := m.chain
+	m.mu.RUnlock()
+	if chain == nil {
+		m.mu.Lock()
+		if m.chain == nil {
+			m.chain = m.dispatch
+			for i := len(m.middleware) - 1; i >= 0; i-- {
+				m.chain = m.middleware[i](m.chain)
+			}
+		}
+		chain = m.chain
+		m.mu.Unlock()
+	}
+	return chain(ctx, e)
+}
+
+func (m *EventMux) dispatch(ctx context.Context, e interface{}) error {
+	m.mu.RLock()
+	handlers := m.handlers[reflect.TypeOf(e)]
+	all := m.all
+	m.mu.RUnlock()
+
+	for _, hs := range [][]*muxHandler{handlers, all} {
+		for _, h := range hs {
+			err := h.fn(ctx, e)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// OnEvent registers fn for every event, after the handlers of the event's type.
+func (m *EventMux) OnEvent(fn EventHandlerFunc) (remove func()) {
+	return m.on(nil, fn)
+}
+
+// on registers fn for events of type t, or all events if t is nil.
+// The returned func removes the handler; calling it more than once is fine.
+func (m *EventMux) on(t reflect.Type, fn EventHandlerFunc) (remove func()) {
+	h := &muxHandler{fn: fn}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t == nil {
+		m.all = append(m.all[:len(m.all):len(m.all)], h)
+	} else {
+		if m.handlers == nil {
+			m.handlers = make(map[reflect.Type][]*muxHandler)
+		}
+		hs := m.handlers[t]
+		m.handlers[t] = append(hs[:len(hs):len(hs)], h)
+	}
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if t == nil {
+			m.all = removeMuxHandler(m.all, h)
+		} else {
+			m.handlers[t] = removeMuxHandler(m.handlers[t], h)
+		}
+	}
+}
+
+func removeMuxHandler(hs []*muxHandler, h *muxHandler) []*muxHandler {
+	for i, h2 := range hs {
+		if h2 == h {
+			hs2 := make([]*muxHandler, 0, len(hs)-1)
+			hs2 = append(hs2, hs[:i]...)
+			return append(hs2, hs[i+1:]...)
+		}
+	}
+	return hs
+}
+
+func (m *EventMux) OnReady(fn func(ctx context.Context, e *EventReady) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventReady)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventReady))
+	})
+}
+
+func (m *EventMux) OnChannelCreate(fn func(ctx context.Context, e *EventChannelCreate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventChannelCreate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventChannelCreate))
+	})
+}
+
+func (m *EventMux) OnChannelUpdate(fn func(ctx context.Context, e *EventChannelUpdate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventChannelUpdate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventChannelUpdate))
+	})
+}
+
+func (m *EventMux) OnChannelDelete(fn func(ctx context.Context, e *EventChannelDelete) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventChannelDelete)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventChannelDelete))
+	})
+}
+
+func (m *EventMux) OnGuildCreate(fn func(ctx context.Context, e *EventGuildCreate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildCreate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildCreate))
+	})
+}
+
+func (m *EventMux) OnGuildUpdate(fn func(ctx context.Context, e *EventGuildUpdate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildUpdate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildUpdate))
+	})
+}
+
+func (m *EventMux) OnGuildDelete(fn func(ctx context.Context, e *EventGuildDelete) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildDelete)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildDelete))
+	})
+}
+
+func (m *EventMux) OnGuildBanAdd(fn func(ctx context.Context, e *EventGuildBanAdd) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildBanAdd)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildBanAdd))
+	})
+}
+
+func (m *EventMux) OnGuildBanRemove(fn func(ctx context.Context, e *EventGuildBanRemove) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildBanRemove)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildBanRemove))
+	})
+}
+
+func (m *EventMux) OnGuildEmojisUpdate(fn func(ctx context.Context, e *EventGuildEmojisUpdate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildEmojisUpdate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildEmojisUpdate))
+	})
+}
+
+func (m *EventMux) OnGuildIntegrationsUpdate(fn func(ctx context.Context, e *EventGuildIntegrationsUpdate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildIntegrationsUpdate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildIntegrationsUpdate))
+	})
+}
+
+func (m *EventMux) OnGuildMemberAdd(fn func(ctx context.Context, e *EventGuildMemberAdd) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildMemberAdd)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildMemberAdd))
+	})
+}
+
+func (m *EventMux) OnGuildMemberRemove(fn func(ctx context.Context, e *EventGuildMemberRemove) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildMemberRemove)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildMemberRemove))
+	})
+}
+
+func (m *EventMux) OnGuildMemberUpdate(fn func(ctx context.Context, e *EventGuildMemberUpdate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildMemberUpdate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildMemberUpdate))
+	})
+}
+
+func (m *EventMux) OnGuildMembersChunk(fn func(ctx context.Context, e *EventGuildMembersChunk) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildMembersChunk)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildMembersChunk))
+	})
+}
+
+func (m *EventMux) OnGuildRoleCreate(fn func(ctx context.Context, e *EventGuildRoleCreate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildRoleCreate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildRoleCreate))
+	})
+}
+
+func (m *EventMux) OnGuildRoleUpdate(fn func(ctx context.Context, e *EventGuildRoleUpdate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildRoleUpdate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildRoleUpdate))
+	})
+}
+
+func (m *EventMux) OnGuildRoleDelete(fn func(ctx context.Context, e *EventGuildRoleDelete) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventGuildRoleDelete)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventGuildRoleDelete))
+	})
+}
+
+func (m *EventMux) OnMessageCreate(fn func(ctx context.Context, e *EventMessageCreate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventMessageCreate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventMessageCreate))
+	})
+}
+
+func (m *EventMux) OnMessageUpdate(fn func(ctx context.Context, e *EventMessageUpdate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventMessageUpdate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventMessageUpdate))
+	})
+}
+
+func (m *EventMux) OnMessageDelete(fn func(ctx context.Context, e *EventMessageDelete) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventMessageDelete)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventMessageDelete))
+	})
+}
+
+func (m *EventMux) OnMessageDeleteBulk(fn func(ctx context.Context, e *EventMessageDeleteBulk) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventMessageDeleteBulk)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventMessageDeleteBulk))
+	})
+}
+
+func (m *EventMux) OnMessageReactionAdd(fn func(ctx context.Context, e *EventMessageReactionAdd) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventMessageReactionAdd)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventMessageReactionAdd))
+	})
+}
+
+func (m *EventMux) OnMessageReactionRemove(fn func(ctx context.Context, e *EventMessageReactionRemove) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventMessageReactionRemove)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventMessageReactionRemove))
+	})
+}
+
+func (m *EventMux) OnMessageReactionRemoveAll(fn func(ctx context.Context, e *EventMessageReactionRemoveAll) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventMessageReactionRemoveAll)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventMessageReactionRemoveAll))
+	})
+}
+
+func (m *EventMux) OnPresenceUpdate(fn func(ctx context.Context, e *EventPresenceUpdate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventPresenceUpdate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventPresenceUpdate))
+	})
+}
+
+func (m *EventMux) OnTypingStart(fn func(ctx context.Context, e *EventTypingStart) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventTypingStart)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventTypingStart))
+	})
+}
+
+func (m *EventMux) OnUserUpdate(fn func(ctx context.Context, e *EventUserUpdate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventUserUpdate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventUserUpdate))
+	})
+}
+
+func (m *EventMux) OnVoiceStateUpdate(fn func(ctx context.Context, e *EventVoiceStateUpdate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventVoiceStateUpdate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventVoiceStateUpdate))
+	})
+}
+
+func (m *EventMux) OnVoiceServerUpdate(fn func(ctx context.Context, e *EventVoiceServerUpdate) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventVoiceServerUpdate)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventVoiceServerUpdate))
+	})
+}
+
+func (m *EventMux) OnUnknown(fn func(ctx context.Context, e *EventUnknown) error) (remove func()) {
+	return m.on(reflect.TypeOf((*EventUnknown)(nil)), func(ctx context.Context, e interface{}) error {
+		return fn(ctx, e.(*EventUnknown))
+	})
+}
+
+// eventName returns the name of an event for logging, e.g. MessageCreate.
+func eventName(e interface{}) string {
+	if eu, ok := e.(*EventUnknown); ok {
+		return eu.Type
+	}
+	name := fmt.Sprintf("%T", e)
+	return name[strings.LastIndex(name, ".Event")+len(".Event"):]
+}
+
+// EventLoggingMiddleware logs every event with its duration and error as key=value pairs.
+func EventLoggingMiddleware(logf func(format string, v ...interface{})) EventMiddleware {
+	return func(next EventHandlerFunc) EventHandlerFunc {
+		return func(ctx context.Context, e interface{}) error {
+			start := time.Now()
+			err := next(ctx, e)
+			d := time.Since(start)
+			if err != nil && err != ErrEventDone {
+				logf("event=%v duration=%v err=%q", eventName(e), d, err)
+				return err
+			}
+			logf("event=%v duration=%v", eventName(e), d)
+			return err
+		}
+	}
+}
+
+// EventRecoverMiddleware turns a panic in a handler into an error with the stack trace.
+// Without it, a panic crashes the GatewayClient's goroutine and the program.
+func EventRecoverMiddleware() EventMiddleware {
+	return func(next EventHandlerFunc) EventHandlerFunc {
+		return func(ctx context.Context, e interface{}) (err error) {
+			defer func() {
+				r := recover()
+				if r != nil {
+					err = fmt.Errorf("panic handling %v: %v\n%s", eventName(e), r, debug.Stack())
+				}
+			}()
+			return next(ctx, e)
+		}
+	}
+}
+
+// GuildFilterMiddleware only lets through events of guilds for which allow returns true.
+// Events outside of guilds, like those in DMs, are always let through.
+// Message events only have a channel ID so s, which may be nil, is used to find their guild.
+// They are let through if their channel is unknown.
+func GuildFilterMiddleware(s *State, allow func(guildID string) bool) EventMiddleware {
+	return func(next EventHandlerFunc) EventHandlerFunc {
+		return func(ctx context.Context, e interface{}) error {
+			gID, ok := EventGuildID(s, e)
+			if ok && !allow(gID) {
+				return nil
+			}
+			return next(ctx, e)
+		}
+	}
+}
+
+// EventGuildID returns the ID of the guild of an event.
+// s is used to find the guild of events that only have a channel ID and may be nil.
+func EventGuildID(s *State, e interface{}) (string, bool) {
+	switch e := e.(type) {
+	case *EventChannelCreate:
+		return e.GuildID, e.GuildID != ""
+	case *EventChannelUpdate:
+		return e.GuildID, e.GuildID != ""
+	case *EventChannelDelete:
+		return e.GuildID, e.GuildID != ""
+	case *EventGuildCreate:
+		return e.ID, true
+	case *EventGuildUpdate:
+		return e.ID, true
+	case *EventGuildDelete:
+		return e.ID, true
+	case *EventGuildBanAdd:
+		return e.GuildID, true
+	case *EventGuildBanRemove:
+		return e.GuildID, true
+	case *EventGuildEmojisUpdate:
+		return e.GuildID, true
+	case *EventGuildIntegrationsUpdate:
+		return e.GuildID, true
+	case *EventGuildMemberAdd:
+		return e.GuildID, true
+	case *EventGuildMemberRemove:
+		return e.GuildID, true
+	case *EventGuildMemberUpdate:
+		return e.GuildID, true
+	case *EventGuildMembersChunk:
+		return e.GuildID, true
+	case *EventGuildRoleCreate:
+		return e.GuildID, true
+	case *EventGuildRoleUpdate:
+		return e.GuildID, true
+	case *EventGuildRoleDelete:
+		return e.GuildID, true
+	case *EventPresenceUpdate:
+		return e.GuildID, e.GuildID != ""
+	case *EventVoiceStateUpdate:
+		return e.GuildID, e.GuildID != ""
+	case *EventVoiceServerUpdate:
+		return e.GuildID, true
+	}
+	cID, ok := eventChannelID(e)
+	if !ok || s == nil {
+		return "", false
+	}
+	sc, ok := s.Channel(cID)
+	if !ok || sc.Guild() == nil {
+		return "", false
+	}
+	return sc.Guild().ID(), true
+}
+
+// eventChannelID returns the ID of the channel of an event.
+func eventChannelID(e interface{}) (string, bool) {
+	switch e := e.(type) {
+	case *EventChannelCreate:
+		return e.ID, true
+	case *EventChannelUpdate:
+		return e.ID, true
+	case *EventChannelDelete:
+		return e.ID, true
+	case *EventMessageCreate:
+		return e.ChannelID, true
+	case *EventMessageUpdate:
+		return e.ChannelID, true
+	case *EventMessageDelete:
+		return e.ChannelID, true
+	case *EventMessageDeleteBulk:
+		return e.ChannelID, true
+	case *EventMessageReactionAdd:
+		return e.ChannelID, true
+	case *EventMessageReactionRemove:
+		return e.ChannelID, true
+	case *EventMessageReactionRemoveAll:
+		return e.ChannelID, true
+	case *EventTypingStart:
+		return e.ChannelID, true
+	}
+	return "", false
+}
@@ -0,0 +1,168 @@
+package discgo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var _ EventHandler = new(EventMux)
+
+func TestEventMux(t *testing.T) {
+	var m EventMux
+	var calls []string
+	m.OnMessageCreate(func(ctx context.Context, e *EventMessageCreate) error {
+		calls = append(calls, "first "+e.Content)
+		return nil
+	})
+	remove := m.OnMessageCreate(func(ctx context.Context, e *EventMessageCreate) error {
+		calls = append(calls, "second "+e.Content)
+		return nil
+	})
+	m.OnEvent(func(ctx context.Context, e interface{}) error {
+		calls = append(calls, "any "+eventName(e))
+		return nil
+	})
+	m.OnGuildDelete(func(ctx context.Context, e *EventGuildDelete) error {
+		return ErrEventDone
+	})
+	m.OnReady(func(ctx context.Context, e *EventReady) error {
+		calls = append(calls, "ready "+e.SessionID)
+		return nil
+	})
+
+	handle := func(e interface{}) error {
+		return m.Handle(context.Background(), e)
+	}
+	mc := new(EventMessageCreate)
+	mc.Content = "owl"
+	err := handle(mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"first owl", "second owl", "any MessageCreate"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected %q but got %q", expected, calls)
+	}
+
+	calls = nil
+	remove()
+	remove()
+	err = handle(mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = handle(&EventUnknown{Type: "BOAR_CREATE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"first owl", "any MessageCreate", "any BOAR_CREATE"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected %q but got %q", expected, calls)
+	}
+
+	calls = nil
+	err = handle(&EventReady{SessionID: "lark"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"ready lark", "any Ready"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected %q but got %q", expected, calls)
+	}
+
+	calls = nil
+	err = handle(new(EventGuildDelete))
+	if err != ErrEventDone {
+		t.Fatalf("expected %v but got %v", ErrEventDone, err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("expected no calls but got %q", calls)
+	}
+}
+
+func TestEventMux_Middleware(t *testing.T) {
+	var m EventMux
+	var calls []string
+	mw := func(name string) EventMiddleware {
+		return func(next EventHandlerFunc) EventHandlerFunc {
+			return func(ctx context.Context, e interface{}) error {
+				calls = append(calls, name)
+				return next(ctx, e)
+			}
+		}
+	}
+	m.Use(mw("outer"), EventRecoverMiddleware())
+	m.OnTypingStart(func(ctx context.Context, e *EventTypingStart) error {
+		calls = append(calls, "handler")
+		panic("owl")
+	})
+
+	err := m.Handle(context.Background(), new(EventTypingStart))
+	if err == nil || !strings.HasPrefix(err.Error(), "panic handling TypingStart: owl") {
+		t.Fatalf("expected panic error but got %v", err)
+	}
+
+	calls = nil
+	m.Use(mw("inner"))
+	m.Handle(context.Background(), new(EventTypingStart))
+	expected := []string{"outer", "inner", "handler"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected %q but got %q", expected, calls)
+	}
+}
+
+func TestEventMux_LoggingMiddleware(t *testing.T) {
+	var logs []string
+	var m EventMux
+	m.Use(EventLoggingMiddleware(func(f string, v ...interface{}) {
+		logs = append(logs, f)
+	}))
+	m.OnUserUpdate(func(ctx context.Context, e *EventUserUpdate) error {
+		return errors.New("owl")
+	})
+	m.Handle(context.Background(), new(EventUserUpdate))
+	m.Handle(context.Background(), new(EventTypingStart))
+	expected := []string{"event=%v duration=%v err=%q", "event=%v duration=%v"}
+	if !reflect.DeepEqual(logs, expected) {
+		t.Fatalf("expected %q but got %q", expected, logs)
+	}
+}
+
+func TestGuildFilterMiddleware(t *testing.T) {
+	s := new(State)
+	s.handle(&EventReady{User: &ModelUser{ID: "1"}})
+	gc := &EventGuildCreate{
+		Channels: []*ModelChannel{{ID: "10", GuildID: "2"}},
+	}
+	gc.ID = "2"
+	err := s.handle(gc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m EventMux
+	m.Use(GuildFilterMiddleware(s, func(gID string) bool {
+		return gID == "3"
+	}))
+	var handled []interface{}
+	m.OnEvent(func(ctx context.Context, e interface{}) error {
+		handled = append(handled, e)
+		return nil
+	})
+
+	inGuild := new(EventMessageCreate)
+	inGuild.ChannelID = "10"
+	dm := new(EventMessageCreate)
+	dm.ChannelID = "11"
+	allowed := &EventGuildMemberAdd{GuildID: "3"}
+	for _, e := range []interface{}{inGuild, dm, &EventGuildMemberAdd{GuildID: "2"}, allowed} {
+		m.Handle(context.Background(), e)
+	}
+	expected := []interface{}{dm, allowed}
+	if !reflect.DeepEqual(handled, expected) {
+		t.Fatalf("expected %v but got %v", expected, handled)
+	}
+}
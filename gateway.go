@@ -1,21 +1,33 @@
 package discgo
 
 import (
+	"bytes"
 	"compress/zlib"
 	"context"
 	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
+	"net/url"
 	"runtime"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/nhooyr/discgo/etf"
 	"github.com/nhooyr/log"
 )
 
+// Encodings of gateway payloads.
+const (
+	EncodingJSON = "json"
+	// The Erlang external term format. Smaller and cheaper to decode than JSON.
+	EncodingETF = "etf"
+)
+
 type EndpointGateway struct {
 	*endpoint
 }
@@ -69,31 +81,97 @@ func (h EventHandlerFunc) Handle(ctx context.Context, e interface{}) error {
 
 type GatewayClient struct {
 	// Configuration. Maybe extract into GatewayClientConfig?
-	Token        string
-	GatewayURL   string
+	Token      string
+	GatewayURL string
+	APIVersion string // defaults to DefaultAPIVersion.
+	// Called by the goroutine reading from the connection. Wrap slow handlers in a Dispatcher.
 	EventHandler EventHandler
+	// Receives every error, including the *GatewayCloseError that terminates the client.
 	ErrorHandler func(err error)
-	Logf         func(format string, v ...interface{})
-	Debug        bool // enables logging of events.
-	Shard        int
-	ShardCount   int
-
-	sessionID    string
-	lastIdentify time.Time
-	ready        bool
-	resuming     bool
-
-	reconnectChan chan struct{}
-	closeChan     chan struct{}
-	wg            sync.WaitGroup
+	// Decides whether to reconnect because of an *EventDecodeError or *EventHandlerError.
+	// By default they are only reported to ErrorHandler.
+	ReconnectError func(err error) bool
+	Logf           func(format string, v ...interface{})
+	Debug          bool // enables logging of events.
+	Shard          int
+	ShardCount     int
+	// Spaces out identifies. Defaults to a new IdentifyLimiter.
+	// Clients with the same token should share one.
+	IdentifyLimiter *IdentifyLimiter
+	// Compresses the whole connection with zlib-stream instead of only large payloads.
+	// Uses much less bandwidth.
+	ZlibStream bool
+	Encoding   string // defaults to EncodingJSON.
+	// Resumed by Connect instead of identifying, unless it belongs to another shard.
+	// If Discord rejects it, the client identifies. A resumed session has no Ready so State
+	// only knows what is dispatched afterwards.
+	Session *Session
+	// Notified of the lifecycle of the connection.
+	Observer LifecycleObserver
+	// Waited before the second reconnect in a row, doubling with every attempt up to MaxReconnectBackoff.
+	// The first reconnect after the connection was ready is immediate.
+	// Defaults to DefaultReconnectBackoff.
+	ReconnectBackoff    time.Duration
+	MaxReconnectBackoff time.Duration // defaults to DefaultMaxReconnectBackoff.
+
+	// Written with heartbeatMu locked as Status reads it.
+	sessionID string
+	// Not locked. Set by connect and serve before readLoop starts, then only by readLoop.
+	ready    bool
+	resuming bool
+
+	// Receives the reason for reconnecting.
+	reconnectChan chan error
+	// Creates closing and done so that Close can be called concurrently with Connect.
+	initOnce sync.Once
+	// Closed by Close.
+	closing   chan struct{}
+	closeOnce sync.Once
+	// Set before closing is closed.
+	closeResumable bool
+	// Sent in the close frame, set by serve before canceling the connection.
+	closeCode int
+	closeText string
+	done      chan struct{}
+	err       error
+	wg        sync.WaitGroup
+
+	lifecycleMu sync.Mutex
+	started     bool
+	closed      bool
 
 	// TODO use other websocket package, it's better for my usecase.
 	wsConn    *websocket.Conn
 	writeChan chan *sentPayload
+	// Only accessed by readLoop. nil unless ZlibStream.
+	zlibStream *zlibStream
 
 	heartbeatMu           sync.Mutex
 	heartbeatAcknowledged bool
 	sequenceNumber        int
+	heartbeatSent         time.Time
+	latency               time.Duration
+	// When the connection received Ready or Resumed, zero while not ready.
+	readyAt time.Time
+	// Reconnect attempts since the client was last ready.
+	attempt int
+
+	statusMu sync.Mutex
+	status   *dataOpStatusUpdate
+	// Whether the session is ready or resumed, Discord rejects status updates until it is.
+	statusReady bool
+	// The status last sent on the current connection.
+	sentStatus *dataOpStatusUpdate
+
+	memberRequestsMu sync.Mutex
+	memberRequests   []*GuildMembersRequest
+	nextNonce        int
+
+	// Written by readLoop with heartbeatMu locked as Status reads it.
+	userID string
+
+	voiceWaitersMu sync.Mutex
+	voiceWaiters   []*voiceWaiter
 }
 
 func (c *GatewayClient) log(v interface{}) {
@@ -120,43 +198,161 @@ func (c *GatewayClient) Connect() error {
 		}
 	}
 
-	c.GatewayURL += "?v=" + apiVersion + "&encoding=json"
-	c.closeChan = make(chan struct{})
-	c.reconnectChan = make(chan struct{})
-	c.writeChan = make(chan *sentPayload)
-	c.ready = true
+	if c.IdentifyLimiter == nil {
+		c.IdentifyLimiter = new(IdentifyLimiter)
+	}
+
+	c.init()
+	c.lifecycleMu.Lock()
+	if c.closed {
+		c.lifecycleMu.Unlock()
+		return errGatewayClosed
+	}
+	if c.started {
+		c.lifecycleMu.Unlock()
+		return errors.New("already connected")
+	}
+	c.started = true
+	c.lifecycleMu.Unlock()
+
+	c.reconnectChan = make(chan error)
 
-	return c.connect()
+	if c.Session != nil && c.sessionID == "" && c.Session.Shard == c.shard() {
+		c.heartbeatMu.Lock()
+		c.sessionID = c.Session.ID
+		c.sequenceNumber = c.Session.Seq
+		c.userID = c.Session.UserID
+		c.heartbeatMu.Unlock()
+	}
+
+	err := c.connect()
+	if err != nil {
+		c.err = err
+		close(c.done)
+		return err
+	}
+	go c.manager()
+	return nil
 }
 
-// If it errors without receiving a operationDispatch payload, then
-// this method will always return an error.
-func (c *GatewayClient) connect() error {
-	if !c.ready {
-		return errors.New("already tried to connect and failed")
+var errGatewayClosed = errors.New("gateway client closed")
+
+// Discord invalidates the session when the connection is closed with 1000 or 1001.
+const closeCodeResumable = 4000
+
+func (c *GatewayClient) init() {
+	c.initOnce.Do(func() {
+		c.closing = make(chan struct{})
+		c.done = make(chan struct{})
+		c.writeChan = make(chan *sentPayload)
+	})
+}
+
+// Run connects and blocks until ctx is canceled or the client terminates.
+// It returns ctx.Err() if ctx was canceled and otherwise the error that terminated the client,
+// which is nil if Close was called.
+func (c *GatewayClient) Run(ctx context.Context) error {
+	err := c.Connect()
+	if err != nil {
+		return err
 	}
+	select {
+	case <-ctx.Done():
+		c.Close()
+		return ctx.Err()
+	case <-c.done:
+		return c.err
+	}
+}
 
+func (c *GatewayClient) connect() error {
 	c.ready = false
 	c.resuming = false
 	c.heartbeatAcknowledged = true
-	c.lastIdentify = time.Time{}
 
 	c.Logf("connecting")
+	c.observe(LifecycleConnecting, nil)
 	// TODO Need to set read deadline for hello packet and I also need to set write deadlines.
 	// TODO also max message
-	var err error
-	c.wsConn, _, err = websocket.DefaultDialer.Dial(c.GatewayURL, nil)
+	dialURL, err := c.dialURL()
 	if err != nil {
 		return err
 	}
-
-	go c.manager()
-
+	c.wsConn, _, err = websocket.DefaultDialer.Dial(dialURL, nil)
+	if err != nil {
+		return err
+	}
+	c.zlibStream = nil
+	if c.ZlibStream {
+		c.zlibStream = new(zlibStream)
+	}
 	return nil
 }
 
+func (c *GatewayClient) dialURL() (string, error) {
+	u, err := url.Parse(c.GatewayURL)
+	if err != nil {
+		return "", err
+	}
+	apiVersion := c.APIVersion
+	if apiVersion == "" {
+		apiVersion = DefaultAPIVersion
+	}
+	q := u.Query()
+	q.Set("v", apiVersion)
+	encoding := c.Encoding
+	if encoding == "" {
+		encoding = EncodingJSON
+	}
+	q.Set("encoding", encoding)
+	if c.ZlibStream {
+		q.Set("compress", "zlib-stream")
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+const (
+	DefaultReconnectBackoff    = time.Second
+	DefaultMaxReconnectBackoff = 2 * time.Minute
+)
+
 func (c *GatewayClient) manager() {
+	defer close(c.done)
+	defer c.dropMemberRequests(errGatewayClosed)
+	for {
+		err := c.serve()
+		if err == nil {
+			c.exit()
+			return
+		}
+
+		if closeErr, ok := err.(*GatewayCloseError); ok {
+			switch closeErr.Code.Action() {
+			case CloseActionFatal:
+				c.Logf("terminated")
+				c.err = closeErr
+				c.observe(LifecycleTerminated, closeErr)
+				return
+			case CloseActionIdentify:
+				c.setSessionID("")
+				c.dropMemberRequests(errSessionInvalidated)
+			}
+		}
+
+		if !c.reconnect() {
+			c.exit()
+			return
+		}
+	}
+}
+
+// serve runs the current connection until it has to reconnect, returning why,
+// or until Close, returning nil.
+func (c *GatewayClient) serve() error {
 	ctx, cancelFn := context.WithCancel(context.Background())
+	// Before readLoop reads it.
+	c.resuming = c.sessionID != ""
 	c.runWorker(func() {
 		c.writeLoop(ctx)
 	})
@@ -164,32 +360,120 @@ func (c *GatewayClient) manager() {
 		c.readLoop(ctx)
 	})
 
-	if c.sessionID == "" {
+	// In a worker as waiting for the IdentifyLimiter or for writeLoop must not block Close
+	// or receiving from reconnectChan.
+	if !c.resuming {
 		c.Logf("identifying")
-		c.identify(ctx)
+		c.runWorker(func() {
+			c.identify(ctx)
+		})
 	} else {
 		c.Logf("resuming")
-		c.resume(ctx)
+		c.runWorker(func() {
+			c.resume(ctx)
+		})
 	}
 
+	var err error
 	select {
-	case <-c.reconnectChan:
-		c.Logf("restarting")
+	case err = <-c.reconnectChan:
+		c.closeCode, c.closeText = closeCodeResumable, "reconnecting"
+	case <-c.closing:
+		c.Logf("exiting")
+		if c.closeResumable {
+			c.closeCode, c.closeText = closeCodeResumable, "closing resumably"
+		} else {
+			// Invalidates the session.
+			c.closeCode, c.closeText = websocket.CloseNormalClosure, "closing"
+		}
+	}
+	cancelFn()
+	c.wg.Wait()
+	c.setReady(false)
+	c.statusMu.Lock()
+	c.statusReady = false
+	c.sentStatus = nil
+	c.statusMu.Unlock()
+	c.observe(LifecycleDisconnected, err)
+	return err
+}
 
-		cancelFn()
-		c.wg.Wait()
+// reconnect dials the gateway until it succeeds, backing off between attempts.
+// It returns false if Close was called.
+func (c *GatewayClient) reconnect() bool {
+	for {
+		c.heartbeatMu.Lock()
+		c.attempt++
+		attempt := c.attempt
+		c.heartbeatMu.Unlock()
+
+		c.Logf("restarting")
+		c.observe(LifecycleReconnecting, nil)
+		t := time.NewTimer(c.backoff(attempt))
+		select {
+		case <-t.C:
+		case <-c.closing:
+			t.Stop()
+			c.Logf("exiting")
+			return false
+		}
 
 		err := c.connect()
-		if err != nil {
-			c.log(err)
+		if err == nil {
+			return true
 		}
-	case <-c.closeChan:
-		c.Logf("exiting")
+		c.ErrorHandler(err)
+		c.observe(LifecycleDisconnected, err)
+	}
+}
 
-		cancelFn()
-		c.wg.Wait()
+// backoff returns how long to wait before a reconnect attempt.
+func (c *GatewayClient) backoff(attempt int) time.Duration {
+	if attempt <= 1 {
+		return 0
+	}
+	d := c.ReconnectBackoff
+	if d <= 0 {
+		d = DefaultReconnectBackoff
+	}
+	max := c.MaxReconnectBackoff
+	if max <= 0 {
+		max = DefaultMaxReconnectBackoff
+	}
+	for i := 2; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	// Jitter so that clients disconnected together do not reconnect together.
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// exit is called by manager after Close.
+func (c *GatewayClient) exit() {
+	if !c.closeResumable {
+		c.setSessionID("")
+	}
+	c.observe(LifecycleTerminated, nil)
+}
+
+// Done returns a channel that is closed when the client has terminated permanently,
+// either because of Close or because the gateway closed the connection with a fatal code.
+func (c *GatewayClient) Done() <-chan struct{} {
+	c.init()
+	return c.done
+}
 
-		c.closeChan <- struct{}{}
+// Err returns the error that terminated the client, a *GatewayCloseError unless Connect failed.
+// It is nil until Done is closed and nil if the client was closed with Close.
+func (c *GatewayClient) Err() error {
+	c.init()
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
 	}
 }
 
@@ -214,6 +498,17 @@ type sentPayload struct {
 	Sequence  int         `json:"s,omitempty"`
 }
 
+func (c *GatewayClient) writePayload(p *sentPayload) error {
+	if c.Encoding != EncodingETF {
+		return c.wsConn.WriteJSON(p)
+	}
+	b, err := etf.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return c.wsConn.WriteMessage(websocket.BinaryMessage, b)
+}
+
 func (c *GatewayClient) writeLoop(ctx context.Context) {
 	t := time.NewTicker(time.Minute)
 	defer t.Stop()
@@ -236,20 +531,15 @@ writeLoop:
 
 			writesLeft--
 
-			_, ok := p.Data.(*dataOpIdentify)
-			if ok {
-				now := time.Now()
-				resetTime := c.lastIdentify.Add(5 * time.Second)
-				time.Sleep(resetTime.Sub(now))
-			}
-
-			err := c.wsConn.WriteJSON(p)
+			err := c.writePayload(p)
 			if err != nil {
 				c.ErrorHandler(err)
 				select {
-				case c.reconnectChan <- struct{}{}:
+				case c.reconnectChan <- err:
 				case <-ctx.Done():
 				}
+				// serve sets the close code before canceling ctx.
+				<-ctx.Done()
 				break writeLoop
 			}
 
@@ -260,10 +550,6 @@ writeLoop:
 				}
 				c.Logf("write: %s", b)
 			}
-
-			if ok {
-				c.lastIdentify = time.Now()
-			}
 		case <-t.C:
 			writesLeft = 120
 		case <-ctx.Done():
@@ -271,7 +557,7 @@ writeLoop:
 		}
 	}
 
-	closeMsg := websocket.FormatCloseMessage(websocket.CloseNoStatusReceived, "no heartbeat acknowledgment")
+	closeMsg := websocket.FormatCloseMessage(c.closeCode, c.closeText)
 	err = c.wsConn.WriteMessage(websocket.CloseMessage, closeMsg)
 	if err != nil {
 		c.ErrorHandler(err)
@@ -284,11 +570,12 @@ writeLoop:
 }
 
 type dataOpIdentify struct {
-	Token          string             `json:"token"`
-	Properties     identifyProperties `json:"properties"`
-	Compress       bool               `json:"compress"`
-	LargeThreshold int                `json:"large_threshold"`
-	Shard          *[2]int            `json:"shard,omitempty"`
+	Token          string              `json:"token"`
+	Properties     identifyProperties  `json:"properties"`
+	Compress       bool                `json:"compress"`
+	LargeThreshold int                 `json:"large_threshold"`
+	Shard          *[2]int             `json:"shard,omitempty"`
+	Presence       *dataOpStatusUpdate `json:"presence,omitempty"`
 }
 
 type identifyProperties struct {
@@ -297,25 +584,74 @@ type identifyProperties struct {
 	Device  string `json:"$device,omitempty"`
 }
 
-func (c *GatewayClient) write(ctx context.Context, p *sentPayload) {
+func (c *GatewayClient) write(ctx context.Context, p *sentPayload) error {
+	c.init()
 	select {
 	case c.writeChan <- p:
+		return nil
+	case <-c.done:
+		return errGatewayClosed
 	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DefaultIdentifyInterval is how often Discord allows a token to identify.
+const DefaultIdentifyInterval = 5 * time.Second
+
+// IdentifyLimiter spaces out identifies. It is safe for concurrent use.
+type IdentifyLimiter struct {
+	Interval time.Duration // defaults to DefaultIdentifyInterval.
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// Wait waits for the next identify slot.
+func (l *IdentifyLimiter) Wait(ctx context.Context) error {
+	interval := l.Interval
+	if interval == 0 {
+		interval = DefaultIdentifyInterval
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	slot := l.next
+	l.next = slot.Add(interval)
+	l.mu.Unlock()
+
+	t := time.NewTimer(slot.Sub(now))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
 func (c *GatewayClient) identify(ctx context.Context) {
+	err := c.IdentifyLimiter.Wait(ctx)
+	if err != nil {
+		return
+	}
+
 	p := &sentPayload{
 		Operation: operationIdentify,
-		Data: dataOpIdentify{
+		Data: &dataOpIdentify{
 			Token: c.Token,
 			Properties: identifyProperties{
 				OS:      runtime.GOOS,
 				Browser: userAgent,
 				Device:  userAgent,
 			},
-			Compress:       true,
+			// Discord does not allow both.
+			Compress:       !c.ZlibStream,
 			LargeThreshold: 250,
+			Presence:       c.identifyStatus(),
 		},
 	}
 
@@ -323,7 +659,10 @@ func (c *GatewayClient) identify(ctx context.Context) {
 		p.Data.(*dataOpIdentify).Shard = &[2]int{c.Shard, c.ShardCount}
 	}
 
-	c.write(ctx, p)
+	err = c.write(ctx, p)
+	if err == nil {
+		c.observe(LifecycleIdentified, nil)
+	}
 }
 
 type dataOpResume struct {
@@ -332,9 +671,8 @@ type dataOpResume struct {
 	Seq       int    `json:"seq"`
 }
 
+// resume is called with c.resuming set.
 func (c *GatewayClient) resume(ctx context.Context) {
-	c.resuming = true
-
 	c.heartbeatMu.Lock()
 	p := &sentPayload{
 		Operation: operationResume,
@@ -348,6 +686,67 @@ func (c *GatewayClient) resume(ctx context.Context) {
 	c.write(ctx, p)
 }
 
+type dataOpStatusUpdate struct {
+	// Unix time in milliseconds of when the client went idle.
+	Since  *int64     `json:"since"`
+	Game   *ModelGame `json:"game"`
+	Status string     `json:"status"`
+	AFK    bool       `json:"afk"`
+}
+
+func (c *GatewayClient) identifyStatus() *dataOpStatusUpdate {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	c.sentStatus = c.status
+	return c.status
+}
+
+// readyStatus lets UpdateStatus write the status and sends it if it was updated
+// since Identify. After resuming it is always sent as Discord may have lost it
+// if it was updated while we were disconnected.
+func (c *GatewayClient) readyStatus(ctx context.Context) {
+	c.statusMu.Lock()
+	c.statusReady = true
+	status := c.status
+	if status == c.sentStatus {
+		c.statusMu.Unlock()
+		return
+	}
+	c.sentStatus = status
+	c.statusMu.Unlock()
+	c.write(ctx, &sentPayload{Operation: operationStatusUpdate, Data: status})
+}
+
+// UpdateStatus updates the presence of the bot. status is one of the Status constants,
+// game may be nil and since is when the bot went idle, if it is.
+// The status is remembered and sent again after reconnecting.
+// Until the session is ready or resumed, the status is only remembered
+// and sent in Identify or once the session is.
+func (c *GatewayClient) UpdateStatus(ctx context.Context, status string, game *ModelGame, afk bool, since time.Time) error {
+	d := &dataOpStatusUpdate{
+		Game:   game,
+		Status: status,
+		AFK:    afk,
+	}
+	if !since.IsZero() {
+		ms := since.UnixNano() / int64(time.Millisecond)
+		d.Since = &ms
+	}
+
+	c.statusMu.Lock()
+	c.status = d
+	ready := c.statusReady
+	if ready {
+		c.sentStatus = d
+	}
+	c.statusMu.Unlock()
+	if !ready {
+		return nil
+	}
+
+	return c.write(ctx, &sentPayload{Operation: operationStatusUpdate, Data: d})
+}
+
 // TODO maybe export?
 func (c *GatewayClient) runWorker(fn func()) {
 	c.wg.Add(1)
@@ -362,6 +761,37 @@ type receivedPayload struct {
 	Data           json.RawMessage `json:"d"`
 	SequenceNumber int             `json:"s"`
 	Type           string          `json:"t,omitempty"` // omitempty for logging purposes
+
+	// Set instead of Data with EncodingETF.
+	etfData etf.RawTerm
+}
+
+// etfReceivedPayload is a receivedPayload encoded with ETF.
+type etfReceivedPayload struct {
+	Operation      int         `json:"op"`
+	Data           etf.RawTerm `json:"d"`
+	SequenceNumber int         `json:"s"`
+	Type           string      `json:"t"`
+}
+
+func (p *receivedPayload) unmarshalData(v interface{}) error {
+	if p.etfData != nil {
+		return etf.Unmarshal(p.etfData, v)
+	}
+	return json.Unmarshal(p.Data, v)
+}
+
+// rawData returns the data as JSON, converting it from ETF if necessary.
+func (p *receivedPayload) rawData() json.RawMessage {
+	if p.Data == nil && p.etfData != nil {
+		b, err := etf.ToJSON(p.etfData)
+		if err != nil {
+			// Only possible if etf.Unmarshal fails too, so there is no need for the error.
+			return nil
+		}
+		p.Data = b
+	}
+	return p.Data
 }
 
 func (c *GatewayClient) readLoop(ctx context.Context) {
@@ -373,7 +803,7 @@ func (c *GatewayClient) readLoop(ctx context.Context) {
 				// It's possible we're being shutdown right now too.
 				// Or maybe manager is already trying to reconnect.
 				select {
-				case c.reconnectChan <- struct{}{}:
+				case c.reconnectChan <- err:
 				case <-ctx.Done():
 				}
 			}
@@ -381,6 +811,7 @@ func (c *GatewayClient) readLoop(ctx context.Context) {
 		}
 
 		if c.Debug {
+			p.rawData()
 			b, err := json.MarshalIndent(p, "", "    ")
 			if err != nil {
 				panic(err)
@@ -394,35 +825,101 @@ func (c *GatewayClient) readLoop(ctx context.Context) {
 			// It's possible we're being shutdown right now.
 			// Or maybe manager is already trying to reconnect.
 			select {
-			case c.reconnectChan <- struct{}{}:
+			case c.reconnectChan <- err:
 			case <-ctx.Done():
 			}
 		}
 	}
 }
 
-func (c *GatewayClient) readPayload() (*receivedPayload, error) {
-	var p receivedPayload
+func (c *GatewayClient) nextReader() (int, io.Reader, error) {
 	msgType, r, err := c.wsConn.NextReader()
+	if err != nil {
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			return 0, nil, &GatewayCloseError{
+				Code: CloseCode(closeErr.Code),
+				Text: closeErr.Text,
+			}
+		}
+		return 0, nil, err
+	}
+	return msgType, r, nil
+}
+
+func (c *GatewayClient) readPayload() (*receivedPayload, error) {
+	msgType, r, err := c.nextReader()
 	if err != nil {
 		return nil, err
 	}
+	var b []byte
 	switch msgType {
 	case websocket.BinaryMessage:
-		var z io.ReadCloser
-		z, err = zlib.NewReader(r)
-		if err != nil {
-			return nil, err
+		if c.zlibStream != nil {
+			b, err = c.readZlibStream(r)
+			break
+		}
+		b, err = ioutil.ReadAll(r)
+		if err == nil && (len(b) == 0 || b[0] != etf.Version) {
+			// Payload compressed on its own because of identify's compress.
+			b, err = inflate(b)
 		}
-		defer z.Close()
-		return &p, json.NewDecoder(z).Decode(&p)
 	case websocket.TextMessage:
-		return &p, json.NewDecoder(r).Decode(&p)
-		// TODO handle close frames!!! print out the error code. Probably with new web socket package.
+		b, err = ioutil.ReadAll(r)
 	default:
 		return nil, errors.New("unexpected websocket message type")
 	}
-	return &p, err
+	if err != nil {
+		return nil, err
+	}
+	return c.decodePayload(b)
+}
+
+func inflate(b []byte) ([]byte, error) {
+	z, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	return ioutil.ReadAll(z)
+}
+
+func (c *GatewayClient) decodePayload(b []byte) (*receivedPayload, error) {
+	var p receivedPayload
+	if c.Encoding != EncodingETF {
+		return &p, json.Unmarshal(b, &p)
+	}
+	var ep etfReceivedPayload
+	err := etf.Unmarshal(b, &ep)
+	if err != nil {
+		return nil, err
+	}
+	p.Operation = ep.Operation
+	p.etfData = ep.Data
+	p.SequenceNumber = ep.SequenceNumber
+	p.Type = ep.Type
+	return &p, nil
+}
+
+// readZlibStream reads messages until a payload is complete and inflates it.
+func (c *GatewayClient) readZlibStream(r io.Reader) ([]byte, error) {
+	for {
+		complete, err := c.zlibStream.readFrom(r)
+		if err != nil {
+			return nil, err
+		}
+		if complete {
+			return c.zlibStream.inflate()
+		}
+
+		var msgType int
+		msgType, r, err = c.nextReader()
+		if err != nil {
+			return nil, err
+		}
+		if msgType != websocket.BinaryMessage {
+			return nil, errors.New("unexpected websocket message type in zlib stream")
+		}
+	}
 }
 
 // TODO https://github.com/golang/go/issues/4373
@@ -446,7 +943,7 @@ func (c *GatewayClient) onPayload(ctx context.Context, p *receivedPayload) error
 	switch p.Operation {
 	case operationHello:
 		var hello dataOpHello
-		err := json.Unmarshal(p.Data, &hello)
+		err := p.unmarshalData(&hello)
 		if err != nil {
 			return err
 		}
@@ -456,29 +953,43 @@ func (c *GatewayClient) onPayload(ctx context.Context, p *receivedPayload) error
 	case operationHeartbeatACK:
 		c.heartbeatMu.Lock()
 		c.heartbeatAcknowledged = true
+		c.latency = time.Since(c.heartbeatSent)
 		c.heartbeatMu.Unlock()
 	case operationInvalidSession:
 		var resumable bool
-		err := json.Unmarshal(p.Data, &resumable)
+		err := p.unmarshalData(&resumable)
 		if err != nil {
 			return err
 		}
 
 		if resumable {
+			c.resuming = true
 			c.resume(ctx)
 		} else {
+			c.dropMemberRequests(errSessionInvalidated)
+
 			// We closed the connection and tried resuming but were too late.
 			// If c.ready, the connection was not closed prior to resuming but rather we are
 			// responding to our active session becoming expired and it turns out we were too late
 			// to resume. In that case, we do not need to wait the random duration to stagger reconnects because
 			// it won't help and we're not reconnecting. If we were too late to resume, it's safe to the gateway is
 			// not under crazy load.
-			if !c.ready && c.resuming {
-				// Sleep for a random amount of time between 1 and 5 seconds.
-				randDur := time.Duration(rand.Int63n(4*int64(time.Second))) + 1
-				time.Sleep(randDur)
-			}
-			c.identify(ctx)
+			stagger := !c.ready && c.resuming
+			// In a worker so that heartbeat ACKs are still read while waiting.
+			c.runWorker(func() {
+				if stagger {
+					// Sleep for a random amount of time between 1 and 5 seconds.
+					randDur := time.Duration(rand.Int63n(4*int64(time.Second))) + 1
+					t := time.NewTimer(randDur)
+					defer t.Stop()
+					select {
+					case <-t.C:
+					case <-ctx.Done():
+						return
+					}
+				}
+				c.identify(ctx)
+			})
 		}
 
 	case operationReconnect:
@@ -492,12 +1003,13 @@ func (c *GatewayClient) onPayload(ctx context.Context, p *receivedPayload) error
 }
 
 func readEvent(p *receivedPayload) (interface{}, error) {
-	e, err := getEventStruct(p.Type)
-	if err != nil {
-		return nil, err
+	e := getEventStruct(p.Type)
+	if eu, ok := e.(*EventUnknown); ok {
+		eu.Raw = p.rawData()
+		return eu, nil
 	}
 
-	err = json.Unmarshal(p.Data, &e)
+	err := p.unmarshalData(e)
 	if err != nil {
 		return nil, err
 	}
@@ -514,19 +1026,41 @@ func (c *GatewayClient) onDispatch(ctx context.Context, p *receivedPayload) erro
 
 	e, err := readEvent(p)
 	if err != nil {
-		return &EventHandlerError{
+		return c.eventError(&EventDecodeError{
 			EventName: p.Type,
-			Event:     e,
+			Raw:       p.rawData(),
 			Err:       err,
-		}
+		})
 	}
 
 	switch e := e.(type) {
 	case *EventReady:
 		c.Logf("ready")
+		c.heartbeatMu.Lock()
 		c.sessionID = e.SessionID
+		c.userID = e.User.ID
+		c.heartbeatMu.Unlock()
+		c.setReady(true)
+		c.readyStatus(ctx)
+		c.observe(LifecycleReady, nil)
+	case *EventVoiceStateUpdate:
+		if e.UserID == c.userID {
+			c.collectVoice(e.GuildID, func(vw *voiceWaiter) {
+				vw.state = e
+			})
+		}
+	case *EventVoiceServerUpdate:
+		c.collectVoice(e.GuildID, func(vw *voiceWaiter) {
+			vw.server = e
+		})
 	case *eventResumed:
 		c.Logf("resumed")
+		c.setReady(true)
+		c.readyStatus(ctx)
+		c.observe(LifecycleResumed, nil)
+	case *EventGuildMembersChunk:
+		// After the EventHandler so that State has the members once the request completes.
+		defer c.collectChunk(e)
 	}
 
 	if c.EventHandler == nil {
@@ -539,12 +1073,22 @@ func (c *GatewayClient) onDispatch(ctx context.Context, p *receivedPayload) erro
 		if err == ErrEventDone {
 			return nil
 		}
-		return &EventHandlerError{
+		return c.eventError(&EventHandlerError{
 			EventName: p.Type,
 			Event:     e,
 			Err:       err,
-		}
+		})
+	}
+	return nil
+}
+
+// eventError returns err if the client should reconnect because of it.
+// Otherwise it is only reported.
+func (c *GatewayClient) eventError(err error) error {
+	if c.ReconnectError != nil && c.ReconnectError(err) {
+		return err
 	}
+	c.ErrorHandler(err)
 	return nil
 }
 
@@ -554,12 +1098,12 @@ func (c *GatewayClient) heartbeatLoop(ctx context.Context, heartbeatInterval int
 	for {
 		select {
 		case <-t.C:
-			err := c.heartbeat()
+			err := c.heartbeat(ctx)
 			if err != nil {
 				c.log(err)
 				// Either we signal a reconnect or we have been signaled to close.
 				select {
-				case c.reconnectChan <- struct{}{}:
+				case c.reconnectChan <- err:
 				case <-ctx.Done():
 				}
 				return
@@ -570,7 +1114,7 @@ func (c *GatewayClient) heartbeatLoop(ctx context.Context, heartbeatInterval int
 	}
 }
 
-func (c *GatewayClient) heartbeat() error {
+func (c *GatewayClient) heartbeat(ctx context.Context) error {
 	c.heartbeatMu.Lock()
 	if !c.heartbeatAcknowledged {
 		c.heartbeatMu.Unlock()
@@ -578,16 +1122,355 @@ func (c *GatewayClient) heartbeat() error {
 	}
 	sequenceNumber := c.sequenceNumber
 	c.heartbeatAcknowledged = false
+	c.heartbeatSent = time.Now()
 	c.heartbeatMu.Unlock()
 
+	// Through writeLoop as the connection does not support concurrent writes.
 	p := &sentPayload{Operation: operationHeartbeat, Data: sequenceNumber}
-	return c.wsConn.WriteJSON(p)
+	c.write(ctx, p)
+	return nil
 }
 
-// Close closes the connection. It never returns an error.
+// Close closes the connection normally, which invalidates the session, and waits for the
+// client to terminate. It never returns an error.
 // All errors will be handled by the ErrorHandler given in the GatewayClientConfig.
+// It is safe to call from any goroutine, more than once and before Connect,
+// which then fails as a GatewayClient cannot be reused.
 func (c *GatewayClient) Close() error {
-	c.closeChan <- struct{}{}
-	<-c.closeChan
+	c.close(false)
 	return nil
 }
+
+func (c *GatewayClient) close(resumable bool) {
+	c.init()
+	c.closeOnce.Do(func() {
+		c.closeResumable = resumable
+		close(c.closing)
+
+		c.lifecycleMu.Lock()
+		c.closed = true
+		if !c.started {
+			// Nothing will close done.
+			close(c.done)
+		}
+		c.lifecycleMu.Unlock()
+	})
+	<-c.done
+}
+
+// Session is a gateway session that can be resumed by a new GatewayClient, even in
+// another process, as long as Discord has not expired it.
+type Session struct {
+	ID  string `json:"id"`
+	Seq int    `json:"seq"`
+	// Shard and shard count the session was identified with.
+	Shard [2]int `json:"shard"`
+	// The ID of the bot, it is only sent in Ready.
+	UserID string `json:"user_id"`
+}
+
+// CloseResumable is like Close but leaves the session resumable and returns it.
+// The session is nil if the client never identified.
+func (c *GatewayClient) CloseResumable() (*Session, error) {
+	c.close(true)
+	c.heartbeatMu.Lock()
+	defer c.heartbeatMu.Unlock()
+	return c.session(), nil
+}
+
+// session is called with heartbeatMu locked.
+func (c *GatewayClient) session() *Session {
+	if c.sessionID == "" {
+		return nil
+	}
+	return &Session{
+		ID:     c.sessionID,
+		Seq:    c.sequenceNumber,
+		Shard:  c.shard(),
+		UserID: c.userID,
+	}
+}
+
+func (c *GatewayClient) shard() [2]int {
+	if c.ShardCount > 1 {
+		return [2]int{c.Shard, c.ShardCount}
+	}
+	return [2]int{0, 1}
+}
+
+type dataOpRequestGuildMembers struct {
+	GuildIDs []string `json:"guild_id"`
+	Query    string   `json:"query"`
+	Limit    int      `json:"limit"`
+	Nonce    string   `json:"nonce"`
+}
+
+// GuildMembersRequest collects the chunks of members sent in response to RequestGuildMembers.
+type GuildMembersRequest struct {
+	c     *GatewayClient
+	nonce string
+	done  chan struct{}
+	// Set before done is closed if the chunks stopped arriving.
+	err error
+
+	mu      sync.Mutex
+	members map[string][]*ModelGuildMember
+	// Guilds with chunks yet to arrive.
+	pending map[string]bool
+}
+
+// Done returns a channel that is closed once every chunk has arrived
+// or the request was dropped or canceled, see Wait.
+func (r *GuildMembersRequest) Done() <-chan struct{} {
+	return r.done
+}
+
+// Members returns the members received so far keyed by guild ID.
+func (r *GuildMembersRequest) Members() map[string][]*ModelGuildMember {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	members := make(map[string][]*ModelGuildMember, len(r.members))
+	for gID, gms := range r.members {
+		members[gID] = append([]*ModelGuildMember(nil), gms...)
+	}
+	return members
+}
+
+// Wait waits for every chunk and returns the members keyed by guild ID.
+// If the session is invalidated or the client terminates first, the request is dropped
+// and Wait returns the members received so far with an error.
+// If ctx expires, the request is canceled.
+func (r *GuildMembersRequest) Wait(ctx context.Context) (map[string][]*ModelGuildMember, error) {
+	select {
+	case <-r.done:
+		return r.Members(), r.err
+	case <-ctx.Done():
+		r.Cancel()
+		return nil, ctx.Err()
+	}
+}
+
+var errGuildMembersRequestCanceled = errors.New("guild members request canceled")
+
+// Cancel abandons the request so that its remaining chunks are ignored.
+// It does nothing if the request has already completed.
+func (r *GuildMembersRequest) Cancel() {
+	r.c.memberRequestsMu.Lock()
+	defer r.c.memberRequestsMu.Unlock()
+	if r.c.removeMemberRequest(r) {
+		r.err = errGuildMembersRequestCanceled
+		close(r.done)
+	}
+}
+
+// add reports whether the chunk belongs to the request and whether the request is complete.
+func (r *GuildMembersRequest) add(e *EventGuildMembersChunk) (ok, complete bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.pending[e.GuildID] {
+		return false, false
+	}
+	r.members[e.GuildID] = append(r.members[e.GuildID], e.Members...)
+	if e.ChunkIndex == e.ChunkCount-1 {
+		delete(r.pending, e.GuildID)
+	}
+	return true, len(r.pending) == 0
+}
+
+// RequestGuildMembers requests the members of the guilds whose username starts with query.
+// An empty query and a limit of 0 request every member.
+// The chunks are still given to the EventHandler, so State is populated too.
+func (c *GatewayClient) RequestGuildMembers(ctx context.Context, guildIDs []string, query string, limit int) (*GuildMembersRequest, error) {
+	r := &GuildMembersRequest{
+		c:       c,
+		done:    make(chan struct{}),
+		members: make(map[string][]*ModelGuildMember),
+		pending: make(map[string]bool),
+	}
+	for _, gID := range guildIDs {
+		r.pending[gID] = true
+	}
+
+	c.memberRequestsMu.Lock()
+	c.nextNonce++
+	r.nonce = strconv.Itoa(c.nextNonce)
+	c.memberRequests = append(c.memberRequests, r)
+	c.memberRequestsMu.Unlock()
+
+	p := &sentPayload{
+		Operation: operationRequestGuildMembers,
+		Data: &dataOpRequestGuildMembers{
+			GuildIDs: guildIDs,
+			Query:    query,
+			Limit:    limit,
+			Nonce:    r.nonce,
+		},
+	}
+	err := c.write(ctx, p)
+	if err != nil {
+		c.memberRequestsMu.Lock()
+		c.removeMemberRequest(r)
+		c.memberRequestsMu.Unlock()
+		return nil, err
+	}
+	return r, nil
+}
+
+// removeMemberRequest is called with memberRequestsMu locked.
+// It reports whether r was pending.
+func (c *GatewayClient) removeMemberRequest(r *GuildMembersRequest) bool {
+	for i, r2 := range c.memberRequests {
+		if r2 == r {
+			c.memberRequests = append(c.memberRequests[:i], c.memberRequests[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+var errSessionInvalidated = errors.New("session invalidated before every guild member chunk arrived")
+
+// dropMemberRequests completes every request with err as their chunks will never arrive.
+func (c *GatewayClient) dropMemberRequests(err error) {
+	c.memberRequestsMu.Lock()
+	defer c.memberRequestsMu.Unlock()
+	for _, r := range c.memberRequests {
+		r.err = err
+		close(r.done)
+	}
+	c.memberRequests = nil
+}
+
+// collectChunk gives the chunk to the oldest request for its guild.
+// The nonce is used to find the request when Discord sends it back.
+func (c *GatewayClient) collectChunk(e *EventGuildMembersChunk) {
+	c.memberRequestsMu.Lock()
+	defer c.memberRequestsMu.Unlock()
+	for i, r := range c.memberRequests {
+		if e.Nonce != "" && e.Nonce != r.nonce {
+			continue
+		}
+		ok, complete := r.add(e)
+		if !ok {
+			continue
+		}
+		if complete {
+			c.memberRequests = append(c.memberRequests[:i], c.memberRequests[i+1:]...)
+			close(r.done)
+		}
+		return
+	}
+}
+
+type dataOpVoiceStateUpdate struct {
+	GuildID   string  `json:"guild_id"`
+	ChannelID *string `json:"channel_id"`
+	SelfMute  bool    `json:"self_mute"`
+	SelfDeaf  bool    `json:"self_deaf"`
+}
+
+// UpdateVoiceState joins, moves between or, if channelID is empty, leaves voice channels of the guild.
+func (c *GatewayClient) UpdateVoiceState(ctx context.Context, guildID, channelID string, selfMute, selfDeaf bool) error {
+	d := &dataOpVoiceStateUpdate{
+		GuildID:  guildID,
+		SelfMute: selfMute,
+		SelfDeaf: selfDeaf,
+	}
+	if channelID != "" {
+		d.ChannelID = &channelID
+	}
+	return c.write(ctx, &sentPayload{Operation: operationVoiceStateUpdate, Data: d})
+}
+
+// VoiceSession is everything needed to connect to the voice server of a guild.
+type VoiceSession struct {
+	GuildID   string
+	ChannelID string
+	UserID    string
+	SessionID string
+	Token     string
+	Endpoint  string
+}
+
+type voiceWaiter struct {
+	guildID string
+	state   *EventVoiceStateUpdate
+	server  *EventVoiceServerUpdate
+	done    chan *VoiceSession
+}
+
+var errJoinVoiceNoChannel = errors.New("cannot join voice without a channel; use LeaveVoice to leave")
+
+// JoinVoice joins the voice channel and waits for our Voice State Update and
+// the Voice Server Update of the guild.
+func (c *GatewayClient) JoinVoice(ctx context.Context, guildID, channelID string, selfMute, selfDeaf bool) (*VoiceSession, error) {
+	if channelID == "" {
+		// Discord sends no Voice Server Update after leaving.
+		return nil, errJoinVoiceNoChannel
+	}
+	vw := &voiceWaiter{
+		guildID: guildID,
+		done:    make(chan *VoiceSession, 1),
+	}
+	c.voiceWaitersMu.Lock()
+	c.voiceWaiters = append(c.voiceWaiters, vw)
+	c.voiceWaitersMu.Unlock()
+	defer c.removeVoiceWaiter(vw)
+
+	err := c.UpdateVoiceState(ctx, guildID, channelID, selfMute, selfDeaf)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case vs := <-vw.done:
+		return vs, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// LeaveVoice leaves the voice channel of the guild. Close the VoiceClient first.
+func (c *GatewayClient) LeaveVoice(ctx context.Context, guildID string) error {
+	return c.UpdateVoiceState(ctx, guildID, "", false, false)
+}
+
+func (c *GatewayClient) removeVoiceWaiter(vw *voiceWaiter) {
+	c.voiceWaitersMu.Lock()
+	defer c.voiceWaitersMu.Unlock()
+	for i, vw2 := range c.voiceWaiters {
+		if vw2 == vw {
+			c.voiceWaiters = append(c.voiceWaiters[:i], c.voiceWaiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *GatewayClient) collectVoice(guildID string, fn func(vw *voiceWaiter)) {
+	c.voiceWaitersMu.Lock()
+	defer c.voiceWaitersMu.Unlock()
+	for _, vw := range c.voiceWaiters {
+		if vw.guildID != guildID {
+			continue
+		}
+		fn(vw)
+		if vw.state == nil || vw.server == nil {
+			continue
+		}
+		vs := &VoiceSession{
+			GuildID:   guildID,
+			ChannelID: vw.state.ChannelID,
+			UserID:    vw.state.UserID,
+			SessionID: vw.state.SessionID,
+			Token:     vw.server.Token,
+			Endpoint:  vw.server.Endpoint,
+		}
+		select {
+		case vw.done <- vs:
+		default:
+			// Already has a session.
+		}
+		vw.state = nil
+		vw.server = nil
+	}
+}
@@ -2,9 +2,16 @@ package discgo
 
 import (
 	"context"
-	"os"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/nhooyr/discgo/discgotest"
 )
 
 func TestGateway_Get(t *testing.T) {
@@ -16,34 +23,954 @@ func TestGateway_Get(t *testing.T) {
 	t.Log(url)
 }
 
-func TestConn_Connect(t *testing.T) {
-	gatewayURL, err := client.Gateway().GetURL(ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
+type testGateway struct {
+	*discgotest.Gateway
+	c      *GatewayClient
+	state  *State
+	events chan interface{}
+}
 
+var errTestHandler = errors.New("handler failed")
+
+// newTestGateway connects a GatewayClient to a fake gateway.
+// The EventHandler fails on messages with the content "fail".
+func newTestGateway(t *testing.T, configure ...func(tg *testGateway)) *testGateway {
+	gw := discgotest.NewGateway("token")
+	gw.HeartbeatInterval = 50 * time.Millisecond
+	tg := &testGateway{
+		Gateway: gw,
+		events:  make(chan interface{}, 100),
+	}
 	s := new(State)
-	c := &GatewayClient{
-		Token:      os.Getenv("DISCORD_TOKEN"),
-		GatewayURL: gatewayURL,
+	tg.state = s
+	tg.c = &GatewayClient{
+		Token:           gw.Token,
+		GatewayURL:      gw.URL,
+		IdentifyLimiter: &IdentifyLimiter{Interval: time.Millisecond},
+		Logf:            t.Logf,
+		ErrorHandler: func(err error) {
+			t.Logf("error: %v", err)
+		},
 		EventHandler: EventHandlerFunc(func(ctx context.Context, e interface{}) error {
 			err := s.handle(e)
 			if err != nil {
 				return err
 			}
-			switch e := e.(type) {
-			case *EventMessageCreate:
-				t.Log(e.Content)
+			if m, ok := e.(*EventMessageCreate); ok && m.Content == "fail" {
+				return errTestHandler
+			}
+			tg.events <- e
+			return nil
+		}),
+	}
+	for _, fn := range configure {
+		fn(tg)
+	}
+	err := tg.c.Connect()
+	if err != nil {
+		gw.Close()
+		t.Fatal(err)
+	}
+	return tg
+}
+
+func (tg *testGateway) close() {
+	tg.c.Close()
+	tg.Gateway.Close()
+}
+
+// next returns the next event, skipping Ready and Resumed.
+func (tg *testGateway) next(t *testing.T) interface{} {
+	for {
+		select {
+		case e := <-tg.events:
+			switch e.(type) {
+			case *EventReady, *eventResumed:
+				continue
 			}
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func (tg *testGateway) nextPayload(t *testing.T, op int) *discgotest.GatewayPayload {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := tg.Next(ctx, op)
+	if err != nil {
+		t.Fatalf("waiting for op %v: %v", op, err)
+	}
+	return p
+}
+
+func (tg *testGateway) dispatch(t *testing.T, content string) {
+	err := tg.Dispatch("MESSAGE_CREATE", map[string]string{"id": "1", "content": content})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (tg *testGateway) expectMessage(t *testing.T, content string) {
+	e, ok := tg.next(t).(*EventMessageCreate)
+	if !ok {
+		t.Fatalf("expected %T", e)
+	}
+	if e.Content != content {
+		t.Fatalf("expected %q but got %q", content, e.Content)
+	}
+}
+
+func (tg *testGateway) expectResume(t *testing.T) {
+	p := tg.nextPayload(t, discgotest.OpResume)
+	var resume dataOpResume
+	err := json.Unmarshal(p.D, &resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resume.SessionID != "1" {
+		t.Fatalf("expected session %v but got %v", "1", resume.SessionID)
+	}
+}
+
+func TestGatewayClient_Connect(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	e := <-tg.events
+	ready, ok := e.(*EventReady)
+	if !ok {
+		t.Fatalf("expected %T but got %T", ready, e)
+	}
+	if ready.User.Username != "discgotest" {
+		t.Fatalf("expected %v but got %v", "discgotest", ready.User.Username)
+	}
+	tg.dispatch(t, "boar")
+	tg.expectMessage(t, "boar")
+	tg.nextPayload(t, discgotest.OpHeartbeat)
+}
+
+func TestGatewayClient_Resume(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	tg.dispatch(t, "boar")
+	tg.expectMessage(t, "boar")
+
+	tg.Drop()
+	// Missed while disconnected.
+	tg.dispatch(t, "heads")
+	tg.expectResume(t)
+	tg.expectMessage(t, "heads")
+	if tg.Connections() != 2 {
+		t.Fatalf("expected %v but got %v connections", 2, tg.Connections())
+	}
+}
+
+func TestGatewayClient_Reconnect(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	err := tg.Reconnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.expectResume(t)
+	tg.dispatch(t, "boar")
+	tg.expectMessage(t, "boar")
+}
+
+func TestGatewayClient_CloseCode(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	err := tg.CloseWithCode(discgotest.CloseUnknownError, "Unknown error.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.expectResume(t)
+}
+
+func TestGatewayClient_CloseCodeIdentify(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	err := tg.CloseWithCode(discgotest.CloseSessionTimeout, "Session timed out.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.nextPayload(t, discgotest.OpIdentify)
+	tg.dispatch(t, "boar")
+	tg.expectMessage(t, "boar")
+}
+
+func TestGatewayClient_CloseCodeFatal(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	err := tg.CloseWithCode(discgotest.CloseAuthenticationFailed, "Authentication failed.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-tg.c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the client to terminate")
+	}
+	closeErr, ok := tg.c.Err().(*GatewayCloseError)
+	if !ok {
+		t.Fatalf("expected *GatewayCloseError but got %v", tg.c.Err())
+	}
+	if closeErr.Code != CloseCodeAuthenticationFailed {
+		t.Fatalf("expected %v but got %v", CloseCodeAuthenticationFailed, closeErr.Code)
+	}
+	if tg.Connections() != 1 {
+		t.Fatalf("expected %v but got %v connections", 1, tg.Connections())
+	}
+}
+
+func newRunGateway(t *testing.T) (*discgotest.Gateway, *GatewayClient) {
+	gw := discgotest.NewGateway("token")
+	gw.HeartbeatInterval = 50 * time.Millisecond
+	c := &GatewayClient{
+		Token:           gw.Token,
+		GatewayURL:      gw.URL,
+		IdentifyLimiter: &IdentifyLimiter{Interval: time.Millisecond},
+		Logf:            t.Logf,
+		EventHandler: EventHandlerFunc(func(ctx context.Context, e interface{}) error {
 			return nil
 		}),
 	}
+	return gw, c
+}
+
+func TestGatewayClient_Run(t *testing.T) {
+	gw, c := newRunGateway(t)
+	defer gw.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Run(ctx)
+	}()
+	nextCtx, nextCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer nextCancel()
+	_, err := gw.Next(nextCtx, discgotest.OpIdentify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case err := <-errs:
+		if err != context.Canceled {
+			t.Fatalf("expected %v but got %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to return")
+	}
+}
+
+func TestGatewayClient_RunFatal(t *testing.T) {
+	gw, c := newRunGateway(t)
+	defer gw.Close()
+	c.Token = "wrong"
+
+	err := c.Run(context.Background())
+	closeErr, ok := err.(*GatewayCloseError)
+	if !ok || closeErr.Code != CloseCodeAuthenticationFailed {
+		t.Fatalf("expected %v but got %v", CloseCodeAuthenticationFailed, err)
+	}
+	// Already terminated.
+	c.Close()
+}
+
+func TestGatewayClient_RunClose(t *testing.T) {
+	gw, c := newRunGateway(t)
+	defer gw.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Run(context.Background())
+	}()
+	c.Close()
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Run to return after Close")
+	}
+
+	// Closed before Run.
+	gw2, c := newRunGateway(t)
+	defer gw2.Close()
+	c.Close()
+	err := c.Run(context.Background())
+	if err != errGatewayClosed {
+		t.Fatalf("expected %v but got %v", errGatewayClosed, err)
+	}
+}
+
+func TestGatewayClient_CloseIdempotent(t *testing.T) {
+	new(GatewayClient).Close()
+
+	tg := newTestGateway(t)
+	defer tg.Gateway.Close()
+	tg.nextPayload(t, discgotest.OpIdentify)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tg.c.Close()
+		}()
+	}
+	wg.Wait()
+	tg.c.Close()
+	sess, err := tg.c.CloseResumable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess != nil {
+		t.Fatalf("expected no session but got %+v", sess)
+	}
+}
+
+func TestGatewayClient_WriteAfterClose(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.Gateway.Close()
+	tg.nextPayload(t, discgotest.OpIdentify)
+	tg.c.Close()
+
+	ctx := context.Background()
+	err := tg.c.UpdateStatus(ctx, StatusIdle, nil, false, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tg.c.RequestGuildMembers(ctx, []string{"1"}, "", 0)
+	if err != errGatewayClosed {
+		t.Fatalf("expected %v but got %v", errGatewayClosed, err)
+	}
+	err = tg.c.UpdateVoiceState(ctx, "1", "2", false, false)
+	if err != errGatewayClosed {
+		t.Fatalf("expected %v but got %v", errGatewayClosed, err)
+	}
+}
+
+func TestGatewayClient_ReconnectBackoff(t *testing.T) {
+	attempts := make(chan int, 100)
+	tg := newTestGateway(t, func(tg *testGateway) {
+		tg.c.ReconnectBackoff = 10 * time.Millisecond
+		tg.c.MaxReconnectBackoff = 20 * time.Millisecond
+		tg.c.Observer = LifecycleObserverFunc(func(e *LifecycleEvent) {
+			if e.Type == LifecycleReconnecting {
+				attempts <- e.Attempt
+			}
+		})
+	})
+	tg.nextPayload(t, discgotest.OpIdentify)
+
+	// Every dial fails now.
+	tg.Gateway.Close()
+	for {
+		select {
+		case attempt := <-attempts:
+			if attempt < 4 {
+				continue
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected reconnect attempts")
+		}
+		break
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		tg.c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Close to return while reconnecting")
+	}
+	if tg.c.Err() != nil {
+		t.Fatalf("expected no error but got %v", tg.c.Err())
+	}
+}
+
+func TestGatewayClient_Backoff(t *testing.T) {
+	c := &GatewayClient{
+		ReconnectBackoff:    time.Second,
+		MaxReconnectBackoff: 4 * time.Second,
+	}
+	if d := c.backoff(1); d != 0 {
+		t.Fatalf("expected %v but got %v", 0, d)
+	}
+	for attempt, max := range map[int]time.Duration{2: time.Second, 3: 2 * time.Second, 4: 4 * time.Second, 100: 4 * time.Second} {
+		d := c.backoff(attempt)
+		if d < max/2 || d > max {
+			t.Fatalf("expected attempt %v to wait between %v and %v but got %v", attempt, max/2, max, d)
+		}
+	}
+}
+
+func TestGatewayClient_HeartbeatTimeout(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	tg.WithholdACKs(true)
+	tg.expectResume(t)
+	tg.WithholdACKs(false)
+	tg.dispatch(t, "boar")
+	tg.expectMessage(t, "boar")
+}
+
+func TestGatewayClient_InvalidSession(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	err := tg.InvalidSession(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.nextPayload(t, discgotest.OpIdentify)
+	tg.dispatch(t, "boar")
+	tg.expectMessage(t, "boar")
+}
+
+func TestGatewayClient_DialURL(t *testing.T) {
+	c := &GatewayClient{
+		GatewayURL: "ws://localhost:8080/gateway",
+		APIVersion: "9",
+	}
+	dialURL, err := c.dialURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "ws://localhost:8080/gateway?encoding=json&v=9"
+	if dialURL != expected {
+		t.Fatalf("expected %v but got %v", expected, dialURL)
+	}
+
+	c.ZlibStream = true
+	dialURL, err = c.dialURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "ws://localhost:8080/gateway?compress=zlib-stream&encoding=json&v=9"
+	if dialURL != expected {
+		t.Fatalf("expected %v but got %v", expected, dialURL)
+	}
+
+	c.Encoding = EncodingETF
+	dialURL, err = c.dialURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "ws://localhost:8080/gateway?compress=zlib-stream&encoding=etf&v=9"
+	if dialURL != expected {
+		t.Fatalf("expected %v but got %v", expected, dialURL)
+	}
+}
+
+func TestGatewayClient_ZlibStream(t *testing.T) {
+	tg := newTestGateway(t, func(tg *testGateway) {
+		tg.c.ZlibStream = true
+	})
+	defer tg.close()
+
+	p := tg.nextPayload(t, discgotest.OpIdentify)
+	var identify dataOpIdentify
+	err := json.Unmarshal(p.D, &identify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identify.Compress {
+		t.Fatal("expected compress to be false with zlib-stream")
+	}
+	tg.dispatch(t, "owl")
+	tg.dispatch(t, "owl")
+	tg.expectMessage(t, "owl")
+	tg.expectMessage(t, "owl")
+
+	// Every connection has its own stream.
+	tg.Drop()
+	tg.expectResume(t)
+	tg.dispatch(t, "lark")
+	tg.expectMessage(t, "lark")
+}
+
+func TestGatewayClient_ETF(t *testing.T) {
+	for _, zlibStream := range []bool{false, true} {
+		tg := newTestGateway(t, func(tg *testGateway) {
+			tg.c.Encoding = EncodingETF
+			tg.c.ZlibStream = zlibStream
+		})
+
+		p := tg.nextPayload(t, discgotest.OpIdentify)
+		var identify dataOpIdentify
+		err := json.Unmarshal(p.D, &identify)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identify.Token != tg.c.Token {
+			t.Fatalf("expected %v but got %v", tg.c.Token, identify.Token)
+		}
+		tg.dispatch(t, "owl")
+		tg.expectMessage(t, "owl")
+
+		err = tg.Dispatch("BOAR_CREATE", map[string]string{"name": "heads"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, ok := tg.next(t).(*EventUnknown)
+		if !ok {
+			t.Fatalf("expected %T", e)
+		}
+		if string(e.Raw) != `{"name":"heads"}` {
+			t.Fatalf("expected %v but got %s", `{"name":"heads"}`, e.Raw)
+		}
+
+		tg.Drop()
+		tg.expectResume(t)
+		tg.dispatch(t, "lark")
+		tg.expectMessage(t, "lark")
+		tg.close()
+	}
+}
+
+func TestGatewayClient_CloseResumable(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.Gateway.Close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	tg.dispatch(t, "owl")
+	tg.expectMessage(t, "owl")
+	sess, err := tg.c.CloseResumable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Session{ID: "1", Seq: 2, Shard: [2]int{0, 1}, UserID: "1"}
+	if !reflect.DeepEqual(sess, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, sess)
+	}
+	if tg.Sessions() != 1 {
+		t.Fatalf("expected %v but got %v sessions", 1, tg.Sessions())
+	}
+	// Missed while the process restarted.
+	tg.dispatch(t, "lark")
+
+	tg2 := newTestGateway(t, func(tg2 *testGateway) {
+		tg2.Gateway.Close()
+		tg2.Gateway = tg.Gateway
+		tg2.c.GatewayURL = tg.URL
+		tg2.c.Session = sess
+	})
+	defer tg2.c.Close()
+	p := tg2.nextPayload(t, discgotest.OpResume)
+	var resume dataOpResume
+	err = json.Unmarshal(p.D, &resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resume.SessionID != sess.ID || resume.Seq != sess.Seq {
+		t.Fatalf("expected session %v at %v but got %v at %v", sess.ID, sess.Seq, resume.SessionID, resume.Seq)
+	}
+	tg2.expectMessage(t, "lark")
+
+	tg2.c.Close()
+	// The gateway sees the close frame after Close returns.
+	deadline := time.Now().Add(5 * time.Second)
+	for tg.Sessions() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v but got %v sessions", 0, tg.Sessions())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGatewayClient_SessionRejected(t *testing.T) {
+	tg := newTestGateway(t, func(tg *testGateway) {
+		tg.c.Session = &Session{ID: "5", Seq: 10, Shard: [2]int{0, 1}, UserID: "1"}
+	})
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpResume)
+	tg.nextPayload(t, discgotest.OpIdentify)
+	tg.dispatch(t, "owl")
+	tg.expectMessage(t, "owl")
+}
+
+func TestGatewayClient_EventUnknown(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	err := tg.Dispatch("BOAR_CREATE", map[string]string{"name": "heads"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := tg.next(t).(*EventUnknown)
+	if !ok {
+		t.Fatalf("expected %T", e)
+	}
+	if e.Type != "BOAR_CREATE" {
+		t.Fatalf("expected %v but got %v", "BOAR_CREATE", e.Type)
+	}
+	if string(e.Raw) != `{"name":"heads"}` {
+		t.Fatalf("expected %v but got %s", `{"name":"heads"}`, e.Raw)
+	}
+	tg.dispatch(t, "boar")
+	tg.expectMessage(t, "boar")
+	if tg.Connections() != 1 {
+		t.Fatalf("expected %v but got %v connections", 1, tg.Connections())
+	}
+}
+
+func TestGatewayClient_EventErrors(t *testing.T) {
+	errs := make(chan error, 10)
+	tg := newTestGateway(t, func(tg *testGateway) {
+		tg.c.ErrorHandler = func(err error) {
+			errs <- err
+		}
+	})
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	err := tg.Dispatch("MESSAGE_CREATE", map[string]int{"content": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := (<-errs).(*EventDecodeError); !ok {
+		t.Fatal("expected *EventDecodeError")
+	}
+	tg.dispatch(t, "fail")
+	if _, ok := (<-errs).(*EventHandlerError); !ok {
+		t.Fatal("expected *EventHandlerError")
+	}
+	tg.dispatch(t, "boar")
+	tg.expectMessage(t, "boar")
+	if tg.Connections() != 1 {
+		t.Fatalf("expected %v but got %v connections", 1, tg.Connections())
+	}
+}
+
+func TestGatewayClient_ReconnectError(t *testing.T) {
+	tg := newTestGateway(t, func(tg *testGateway) {
+		tg.c.ReconnectError = func(err error) bool {
+			herr, ok := err.(*EventHandlerError)
+			return ok && herr.Err == errTestHandler
+		}
+	})
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	tg.dispatch(t, "fail")
+	tg.expectResume(t)
+}
+
+func TestGatewayClient_UpdateStatus(t *testing.T) {
+	tg := newTestGateway(t, func(tg *testGateway) {
+		err := tg.c.UpdateStatus(ctx, StatusIdle, &ModelGame{Name: "boar"}, true, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer tg.close()
+
+	p := tg.nextPayload(t, discgotest.OpIdentify)
+	var identify dataOpIdentify
+	err := json.Unmarshal(p.D, &identify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identify.Presence == nil || identify.Presence.Status != StatusIdle || identify.Presence.Since == nil {
+		t.Fatalf("expected idle presence but got %+v", identify.Presence)
+	}
+
+	expectStatus := func(status, game string) {
+		p := tg.nextPayload(t, discgotest.OpStatusUpdate)
+		var d dataOpStatusUpdate
+		err := json.Unmarshal(p.D, &d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Status != status {
+			t.Fatalf("expected %v but got %v", status, d.Status)
+		}
+		if d.Game == nil || d.Game.Name != game {
+			t.Fatalf("expected game %v but got %+v", game, d.Game)
+		}
+	}
+
+	err = tg.c.UpdateStatus(ctx, StatusDND, &ModelGame{Name: "heads"}, false, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(StatusDND, "heads")
+
+	tg.Drop()
+	tg.expectResume(t)
+	expectStatus(StatusDND, "heads")
+}
+
+func TestGatewayClient_UpdateStatusBeforeReady(t *testing.T) {
+	tg := newTestGateway(t, func(tg *testGateway) {
+		tg.c.IdentifyLimiter = &IdentifyLimiter{Interval: 100 * time.Millisecond}
+		// Delays the client's identify.
+		tg.c.IdentifyLimiter.Wait(ctx)
+	})
+	defer tg.close()
+
+	err := tg.c.UpdateStatus(ctx, StatusDND, nil, false, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := tg.nextPayload(t, discgotest.OpIdentify)
+	var identify dataOpIdentify
+	err = json.Unmarshal(p.D, &identify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identify.Presence == nil || identify.Presence.Status != StatusDND {
+		t.Fatalf("expected dnd presence but got %+v", identify.Presence)
+	}
+	tg.dispatch(t, "owl")
+	tg.expectMessage(t, "owl")
+	if tg.Connections() != 1 {
+		t.Fatalf("expected %v but got %v connections", 1, tg.Connections())
+	}
+}
+
+func TestGatewayClient_RequestGuildMembers(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	member := func(id int) map[string]interface{} {
+		return map[string]interface{}{
+			"user": map[string]string{"id": strconv.Itoa(id), "username": "boar"},
+		}
+	}
+	err := tg.Dispatch("GUILD_CREATE", map[string]interface{}{
+		"id":           gID,
+		"name":         "discgo",
+		"large":        true,
+		"member_count": 2001,
+		"members":      []interface{}{member(0)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	err = c.Connect()
+	r, err := tg.c.RequestGuildMembers(ctx, []string{gID}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := tg.nextPayload(t, discgotest.OpRequestGuildMembers)
+	var d dataOpRequestGuildMembers
+	err = json.Unmarshal(p.D, &d)
 	if err != nil {
 		t.Fatal(err)
 	}
-	time.Sleep(time.Second * 6)
-	c.reconnectChan <- struct{}{}
-	time.Sleep(time.Second * 20)
+	if len(d.GuildIDs) != 1 || d.GuildIDs[0] != gID {
+		t.Fatalf("expected %v but got %v", []string{gID}, d.GuildIDs)
+	}
+
+	// The last chunk is full.
+	for i := 0; i < 2; i++ {
+		var members []interface{}
+		for j := 0; j < 1000; j++ {
+			members = append(members, member(1+i*1000+j))
+		}
+		err = tg.Dispatch("GUILD_MEMBERS_CHUNK", map[string]interface{}{
+			"guild_id":    gID,
+			"members":     members,
+			"chunk_index": i,
+			"chunk_count": 2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	members, err := r.Wait(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members[gID]) != 2000 {
+		t.Fatalf("expected %v but got %v members", 2000, len(members[gID]))
+	}
+	sg, ok := tg.state.Guild(gID)
+	if !ok {
+		t.Fatal("expected guild in state")
+	}
+	if len(sg.Members()) != 2001 {
+		t.Fatalf("expected %v but got %v members in state", 2001, len(sg.Members()))
+	}
+}
+
+func TestGatewayClient_RequestGuildMembersDropped(t *testing.T) {
+	tg := newTestGateway(t)
+	defer tg.close()
+	tg.nextPayload(t, discgotest.OpIdentify)
+
+	r, err := tg.c.RequestGuildMembers(ctx, []string{gID}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.nextPayload(t, discgotest.OpRequestGuildMembers)
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = r.Wait(ctx2)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	tg.c.memberRequestsMu.Lock()
+	n := len(tg.c.memberRequests)
+	tg.c.memberRequestsMu.Unlock()
+	if n != 0 {
+		t.Fatalf("expected %v but got %v requests", 0, n)
+	}
+	select {
+	case <-r.Done():
+	default:
+		t.Fatal("expected canceled request to be done")
+	}
+	_, err = r.Wait(ctx)
+	if err != errGuildMembersRequestCanceled {
+		t.Fatalf("expected %v but got %v", errGuildMembersRequestCanceled, err)
+	}
+
+	r, err = tg.c.RequestGuildMembers(ctx, []string{gID}, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tg.nextPayload(t, discgotest.OpRequestGuildMembers)
+	err = tg.InvalidSession(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx2, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err = r.Wait(ctx2)
+	if err != errSessionInvalidated {
+		t.Fatalf("expected %v but got %v", errSessionInvalidated, err)
+	}
+}
+
+func TestGatewayClient_JoinVoice(t *testing.T) {
+	tg := newTestGateway(t, func(tg *testGateway) {
+		tg.VoiceEndpoint = "localhost:1234"
+	})
+	defer tg.close()
+
+	tg.nextPayload(t, discgotest.OpIdentify)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	vs, err := tg.c.JoinVoice(ctx, gID, cID, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &VoiceSession{
+		GuildID:   gID,
+		ChannelID: cID,
+		UserID:    "1",
+		SessionID: "1",
+		Token:     discgotest.VoiceToken,
+		Endpoint:  "localhost:1234",
+	}
+	if *vs != *expected {
+		t.Fatalf("expected %+v but got %+v", expected, vs)
+	}
+
+	_, err = tg.c.JoinVoice(ctx, gID, "", false, false)
+	if err != errJoinVoiceNoChannel {
+		t.Fatalf("expected %v but got %v", errJoinVoiceNoChannel, err)
+	}
+	err = tg.c.LeaveVoice(ctx, gID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first is from JoinVoice.
+	tg.nextPayload(t, discgotest.OpVoiceStateUpdate)
+	p := tg.nextPayload(t, discgotest.OpVoiceStateUpdate)
+	var d dataOpVoiceStateUpdate
+	err = json.Unmarshal(p.D, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ChannelID != nil {
+		t.Fatalf("expected nil channel but got %v", *d.ChannelID)
+	}
+}
+
+// readRecordedEvent decodes a recorded payload from testdata with the given encoding.
+func readRecordedEvent(b []byte, encoding string) (interface{}, error) {
+	c := &GatewayClient{Encoding: encoding}
+	p, err := c.decodePayload(b)
+	if err != nil {
+		return nil, err
+	}
+	return readEvent(p)
+}
+
+var recordedPayloads = map[string]string{
+	EncodingJSON: "testdata/guildCreate.json",
+	EncodingETF:  "testdata/guildCreate.etf",
+}
+
+func TestReadEvent_ETF(t *testing.T) {
+	events := make(map[string]interface{})
+	for encoding, name := range recordedPayloads {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := readRecordedEvent(b, encoding)
+		if err != nil {
+			t.Fatalf("%v: %v", encoding, err)
+		}
+		events[encoding] = e
+	}
+	gc, ok := events[EncodingETF].(*EventGuildCreate)
+	if !ok {
+		t.Fatalf("expected %T", gc)
+	}
+	if len(gc.Members) != 250 || len(gc.Roles) != 40 {
+		t.Fatalf("expected %v members and %v roles but got %v and %v", 250, 40, len(gc.Members), len(gc.Roles))
+	}
+	if !reflect.DeepEqual(events[EncodingJSON], events[EncodingETF]) {
+		t.Fatal("expected ETF and JSON events to be equal")
+	}
+}
+
+func BenchmarkReadEvent(b *testing.B) {
+	for _, encoding := range []string{EncodingJSON, EncodingETF} {
+		p, err := ioutil.ReadFile(recordedPayloads[encoding])
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(encoding, func(b *testing.B) {
+			b.SetBytes(int64(len(p)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := readRecordedEvent(p, encoding)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
 }
@@ -2,6 +2,7 @@ package discgo
 
 import (
 	"context"
+	"fmt"
 	"net/url"
 	"strconv"
 	"time"
@@ -51,6 +52,22 @@ const (
 	LevelVerificationVeryHigh
 )
 
+// GuildIconURL returns the CDN URL of the icon of g or "" if it has none.
+func (c *RESTClient) GuildIconURL(g *ModelGuild) string {
+	if g.Icon == "" {
+		return ""
+	}
+	return fmt.Sprintf("%v/icons/%v/%v.png", c.cdnURL(), g.ID, g.Icon)
+}
+
+// GuildSplashURL returns the CDN URL of the splash of g or "" if it has none.
+func (c *RESTClient) GuildSplashURL(g *ModelGuild) string {
+	if g.Splash == "" {
+		return ""
+	}
+	return fmt.Sprintf("%v/splashes/%v/%v.png", c.cdnURL(), g.ID, g.Splash)
+}
+
 type ModelGuildEmbed struct {
 	Enabled   bool   `json:"enabled,omitempty"`
 	ChannelID string `json:"channel_id,omitempty"`
@@ -93,6 +110,11 @@ type ModelGuildEmoji struct {
 	Managed       bool     `json:"managed"`
 }
 
+// EmojiURL returns the CDN URL of the image of a custom emoji.
+func (c *RESTClient) EmojiURL(emojiID string) string {
+	return fmt.Sprintf("%v/emojis/%v.png", c.cdnURL(), emojiID)
+}
+
 type EndpointGuilds struct {
 	*endpoint
 }
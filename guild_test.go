@@ -18,11 +18,20 @@ func TestClient_CreateGuild(t *testing.T) {
 }
 
 func TestClient_DeleteGuild(t *testing.T) {
-	g, err := client.Guild(gID).Delete(ctx)
+	params := &ParamsGuildsCreate{
+		Name: "boar",
+	}
+	g, err := client.Guilds().Create(ctx, params)
 	if err != nil {
 		t.Fatal(err)
 	}
-	t.Log(g.ID)
+	_, err = client.Guild(g.ID).Delete(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.Guild(g.ID) != nil {
+		t.Fatalf("expected guild %v to be deleted", g.ID)
+	}
 }
 
 func TestClient_GetChannels(t *testing.T) {
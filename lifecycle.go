@@ -0,0 +1,126 @@
+package discgo
+
+import (
+	"fmt"
+	"time"
+)
+
+// LifecycleEventType is a step in the lifecycle of a GatewayClient's connection.
+type LifecycleEventType int
+
+const (
+	// Dialing the gateway, first or after a disconnect.
+	LifecycleConnecting LifecycleEventType = iota
+	// Identify was sent.
+	LifecycleIdentified
+	LifecycleReady
+	LifecycleResumed
+	// The connection was lost or closed. Err is the reason, nil if because of Close.
+	LifecycleDisconnected
+	// About to reconnect. Attempt counts the reconnects since the client was last ready.
+	LifecycleReconnecting
+	// The client will not reconnect. Err is the reason, nil if because of Close.
+	LifecycleTerminated
+)
+
+func (t LifecycleEventType) String() string {
+	switch t {
+	case LifecycleConnecting:
+		return "connecting"
+	case LifecycleIdentified:
+		return "identified"
+	case LifecycleReady:
+		return "ready"
+	case LifecycleResumed:
+		return "resumed"
+	case LifecycleDisconnected:
+		return "disconnected"
+	case LifecycleReconnecting:
+		return "reconnecting"
+	case LifecycleTerminated:
+		return "terminated"
+	}
+	return fmt.Sprintf("LifecycleEventType(%d)", int(t))
+}
+
+// LifecycleEvent describes a step in the lifecycle of a GatewayClient's connection.
+type LifecycleEvent struct {
+	Type    LifecycleEventType
+	Time    time.Time
+	Attempt int
+	Err     error
+}
+
+// LifecycleObserver is notified of every LifecycleEvent of a GatewayClient.
+// It is called synchronously by the client's goroutines so it must not block.
+type LifecycleObserver interface {
+	ObserveLifecycle(e *LifecycleEvent)
+}
+
+type LifecycleObserverFunc func(e *LifecycleEvent)
+
+func (o LifecycleObserverFunc) ObserveLifecycle(e *LifecycleEvent) {
+	o(e)
+}
+
+func (c *GatewayClient) observe(t LifecycleEventType, err error) {
+	if c.Observer == nil {
+		return
+	}
+	c.heartbeatMu.Lock()
+	attempt := c.attempt
+	c.heartbeatMu.Unlock()
+	c.Observer.ObserveLifecycle(&LifecycleEvent{
+		Type:    t,
+		Time:    time.Now(),
+		Attempt: attempt,
+		Err:     err,
+	})
+}
+
+func (c *GatewayClient) setReady(ready bool) {
+	c.heartbeatMu.Lock()
+	defer c.heartbeatMu.Unlock()
+	if ready {
+		c.readyAt = time.Now()
+		c.attempt = 0
+	} else {
+		c.readyAt = time.Time{}
+	}
+}
+
+func (c *GatewayClient) setSessionID(sessionID string) {
+	c.heartbeatMu.Lock()
+	c.sessionID = sessionID
+	c.heartbeatMu.Unlock()
+}
+
+// GatewayStatus is a snapshot of the health of a GatewayClient.
+type GatewayStatus struct {
+	// Whether the connection has received Ready or Resumed.
+	Ready bool
+	// nil until Ready or if the session was invalidated. Includes the sequence number.
+	Session *Session
+	// Round trip time of the last acknowledged heartbeat, 0 until one is.
+	Latency time.Duration
+	// How long the connection has been ready, 0 while not ready.
+	Uptime time.Duration
+	// Reconnects since the client was last ready.
+	Attempt int
+}
+
+// Status returns the current GatewayStatus. It is safe to call concurrently.
+func (c *GatewayClient) Status() *GatewayStatus {
+	c.heartbeatMu.Lock()
+	defer c.heartbeatMu.Unlock()
+	st := &GatewayStatus{
+		Ready:   !c.readyAt.IsZero(),
+		Session: c.session(),
+		Latency: c.latency,
+		Attempt: c.attempt,
+	}
+	if st.Ready {
+		st.Uptime = time.Since(c.readyAt)
+	}
+	return st
+}
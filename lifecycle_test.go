@@ -0,0 +1,80 @@
+package discgo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGatewayClient_Lifecycle(t *testing.T) {
+	events := make(chan *LifecycleEvent, 100)
+	tg := newTestGateway(t, func(tg *testGateway) {
+		tg.c.Observer = LifecycleObserverFunc(func(e *LifecycleEvent) {
+			events <- e
+		})
+	})
+	defer tg.close()
+
+	expectLifecycle := func(expected ...LifecycleEventType) []*LifecycleEvent {
+		var got []*LifecycleEvent
+		var types []LifecycleEventType
+		for range expected {
+			select {
+			case e := <-events:
+				got = append(got, e)
+				types = append(types, e.Type)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected %v but got %v", expected, types)
+			}
+		}
+		if !reflect.DeepEqual(types, expected) {
+			t.Fatalf("expected %v but got %v", expected, types)
+		}
+		return got
+	}
+
+	expectLifecycle(LifecycleConnecting, LifecycleIdentified, LifecycleReady)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for tg.c.Status().Latency == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected heartbeat latency")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	st := tg.c.Status()
+	if !st.Ready || st.Uptime <= 0 || st.Session == nil || st.Session.ID != "1" {
+		t.Fatalf("expected ready status with session but got %+v", st)
+	}
+
+	tg.Drop()
+	got := expectLifecycle(LifecycleDisconnected, LifecycleReconnecting, LifecycleConnecting, LifecycleResumed)
+	if got[0].Err == nil {
+		t.Fatal("expected disconnect reason")
+	}
+	if got[1].Attempt != 1 {
+		t.Fatalf("expected attempt %v but got %v", 1, got[1].Attempt)
+	}
+	if got[3].Attempt != 0 {
+		t.Fatalf("expected attempt %v but got %v", 0, got[3].Attempt)
+	}
+
+	tg.c.Close()
+	got = expectLifecycle(LifecycleDisconnected, LifecycleTerminated)
+	if got[1].Err != nil {
+		t.Fatalf("expected no error but got %v", got[1].Err)
+	}
+	st = tg.c.Status()
+	if st.Ready || st.Session != nil {
+		t.Fatalf("expected closed status but got %+v", st)
+	}
+}
+
+func TestLifecycleEventType_String(t *testing.T) {
+	if LifecycleReconnecting.String() != "reconnecting" {
+		t.Fatalf("expected %v but got %v", "reconnecting", LifecycleReconnecting)
+	}
+	if LifecycleEventType(42).String() != "LifecycleEventType(42)" {
+		t.Fatalf("expected %v but got %v", "LifecycleEventType(42)", LifecycleEventType(42))
+	}
+}
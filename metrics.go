@@ -0,0 +1,213 @@
+package discgo
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a monotonically increasing value. It is safe for concurrent use.
+type Counter struct {
+	v uint64
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+// Histogram counts observations into buckets like a Prometheus histogram.
+// It is safe for concurrent use.
+type Histogram struct {
+	mu sync.Mutex
+	// Sorted upper bounds of the buckets. An implicit +Inf bucket follows.
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func NewHistogram(bounds []float64) *Histogram {
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+// HistogramSnapshot is the state of a Histogram at one point in time.
+type HistogramSnapshot struct {
+	// Cumulative counts of the observations less than or equal to each upper bound.
+	// The last bucket has an upper bound of +Inf and so equals Count.
+	Buckets []HistogramBucket
+	Count   uint64
+	Sum     float64
+}
+
+type HistogramBucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hs := HistogramSnapshot{
+		Buckets: make([]HistogramBucket, len(h.counts)),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+	var cumulative uint64
+	for i, c := range h.counts {
+		cumulative += c
+		hs.Buckets[i].Count = cumulative
+		if i < len(h.bounds) {
+			hs.Buckets[i].UpperBound = h.bounds[i]
+		} else {
+			hs.Buckets[i].UpperBound = math.Inf(1)
+		}
+	}
+	return hs
+}
+
+// DefaultDurationBounds are the default histogram bounds for request durations in seconds.
+var DefaultDurationBounds = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// RESTMetrics collects metrics of the requests sent by a RESTClient.
+// Add its Middleware to RESTClient.Middlewares.
+type RESTMetrics struct {
+	bounds []float64
+
+	mu        sync.Mutex
+	requests  map[RequestLabels]*Counter
+	retries   map[string]*Counter
+	durations map[string]*Histogram
+}
+
+// RequestLabels identify a counter of requests.
+type RequestLabels struct {
+	RateLimitPath string
+	Method        string
+	// Zero if the request failed without a response.
+	StatusCode int
+}
+
+// NewRESTMetrics returns RESTMetrics whose duration histograms use the given bounds
+// in seconds. If bounds is nil, DefaultDurationBounds is used.
+func NewRESTMetrics(bounds []float64) *RESTMetrics {
+	if bounds == nil {
+		bounds = DefaultDurationBounds
+	}
+	return &RESTMetrics{
+		bounds:    bounds,
+		requests:  make(map[RequestLabels]*Counter),
+		retries:   make(map[string]*Counter),
+		durations: make(map[string]*Histogram),
+	}
+}
+
+func (m *RESTMetrics) Middleware() Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(ri *RequestInfo) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(ri)
+			d := time.Since(start)
+
+			labels := RequestLabels{
+				RateLimitPath: ri.RateLimitPath,
+				Method:        ri.Request.Method,
+			}
+			if err == nil {
+				labels.StatusCode = resp.StatusCode
+			}
+			m.requestsCounter(labels).Inc()
+			if ri.Attempt > 1 {
+				m.retriesCounter(ri.RateLimitPath).Inc()
+			}
+			m.durationHistogram(ri.RateLimitPath).Observe(d.Seconds())
+			return resp, err
+		}
+	}
+}
+
+func (m *RESTMetrics) requestsCounter(labels RequestLabels) *Counter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.requests[labels]
+	if !ok {
+		c = new(Counter)
+		m.requests[labels] = c
+	}
+	return c
+}
+
+func (m *RESTMetrics) retriesCounter(rateLimitPath string) *Counter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.retries[rateLimitPath]
+	if !ok {
+		c = new(Counter)
+		m.retries[rateLimitPath] = c
+	}
+	return c
+}
+
+func (m *RESTMetrics) durationHistogram(rateLimitPath string) *Histogram {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.durations[rateLimitPath]
+	if !ok {
+		h = NewHistogram(m.bounds)
+		m.durations[rateLimitPath] = h
+	}
+	return h
+}
+
+// Requests returns the number of attempts sent by labels.
+func (m *RESTMetrics) Requests() map[RequestLabels]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	requests := make(map[RequestLabels]uint64, len(m.requests))
+	for labels, c := range m.requests {
+		requests[labels] = c.Value()
+	}
+	return requests
+}
+
+// Retries returns the number of retried attempts by route.
+func (m *RESTMetrics) Retries() map[string]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	retries := make(map[string]uint64, len(m.retries))
+	for path, c := range m.retries {
+		retries[path] = c.Value()
+	}
+	return retries
+}
+
+// Durations returns the histograms of attempt durations in seconds by route.
+func (m *RESTMetrics) Durations() map[string]HistogramSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	durations := make(map[string]HistogramSnapshot, len(m.durations))
+	for path, h := range m.durations {
+		durations[path] = h.Snapshot()
+	}
+	return durations
+}
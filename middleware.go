@@ -0,0 +1,43 @@
+package discgo
+
+import (
+	"net/http"
+	"time"
+)
+
+// RequestInfo describes a single attempt of a request sent by a RESTClient.
+type RequestInfo struct {
+	Request *http.Request
+	// The route of the request, see RateLimiter.
+	RateLimitPath string
+	// Starts at 1 and is incremented on every retry.
+	Attempt int
+}
+
+// RoundTripFunc sends a single attempt of a request.
+type RoundTripFunc func(ri *RequestInfo) (*http.Response, error)
+
+// Middleware wraps the RoundTripFunc of a RESTClient. It runs after the RateLimiter
+// lets the attempt through and may modify the request before calling next.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// LoggingMiddleware logs every attempt with its route, status, duration and rate limit bucket
+// as key=value pairs.
+func LoggingMiddleware(logf func(format string, v ...interface{})) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(ri *RequestInfo) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(ri)
+			d := time.Since(start)
+			if err != nil {
+				logf("method=%v route=%v attempt=%v duration=%v err=%q",
+					ri.Request.Method, ri.RateLimitPath, ri.Attempt, d, err)
+				return resp, err
+			}
+			logf("method=%v route=%v attempt=%v duration=%v status=%v bucket=%q remaining=%q",
+				ri.Request.Method, ri.RateLimitPath, ri.Attempt, d, resp.StatusCode,
+				resp.Header.Get("X-RateLimit-Bucket"), resp.Header.Get("X-RateLimit-Remaining"))
+			return resp, err
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package discgo
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_Middlewares(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.Header.Get("X-Trace-ID") != "abc" {
+			t.Errorf("expected trace header to be set")
+		}
+		w.Header().Set("X-RateLimit-Bucket", "bucket")
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var logs []string
+	m := NewRESTMetrics(nil)
+	c := &RESTClient{
+		RetryPolicy: &RetryPolicy{
+			MaxAttempts: 2,
+			StatusCodes: []int{http.StatusBadGateway},
+		},
+		Middlewares: []Middleware{
+			LoggingMiddleware(func(f string, v ...interface{}) {
+				logs = append(logs, fmt.Sprintf(f, v...))
+			}),
+			m.Middleware(),
+			func(next RoundTripFunc) RoundTripFunc {
+				return func(ri *RequestInfo) (*http.Response, error) {
+					ri.Request.Header.Set("X-Trace-ID", "abc")
+					return next(ri)
+				}
+			},
+		},
+	}
+	e := EndpointChannel{&endpoint{c: c, url: srv.URL, rateLimitPath: "/channels/1"}}
+	_, err := e.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(logs) != 2 {
+		t.Fatalf("expected %v logs but got %v", 2, len(logs))
+	}
+	if !strings.Contains(logs[1], `route=/channels/1 attempt=2`) || !strings.Contains(logs[1], `bucket="bucket"`) {
+		t.Fatalf("unexpected log %q", logs[1])
+	}
+
+	requests := m.Requests()
+	for _, status := range []int{http.StatusBadGateway, http.StatusOK} {
+		labels := RequestLabels{RateLimitPath: "/channels/1", Method: "GET", StatusCode: status}
+		if requests[labels] != 1 {
+			t.Fatalf("expected %v requests for %v but got %v", 1, labels, requests[labels])
+		}
+	}
+	if m.Retries()["/channels/1"] != 1 {
+		t.Fatalf("expected %v retries but got %v", 1, m.Retries()["/channels/1"])
+	}
+	hs := m.Durations()["/channels/1"]
+	if hs.Count != 2 || hs.Buckets[len(hs.Buckets)-1].Count != 2 {
+		t.Fatalf("expected %v durations but got %+v", 2, hs)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{1, 0.1})
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(0.5)
+	h.Observe(time.Minute.Seconds())
+
+	hs := h.Snapshot()
+	expected := []uint64{2, 3, 4}
+	for i, b := range hs.Buckets {
+		if b.Count != expected[i] {
+			t.Fatalf("expected bucket %v to have %v but got %v", b.UpperBound, expected[i], b.Count)
+		}
+	}
+	if hs.Sum != 60.65 {
+		t.Fatalf("expected sum %v but got %v", 60.65, hs.Sum)
+	}
+}
@@ -1,104 +1,383 @@
 package discgo
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
+// RateLimiter limits the requests a RESTClient sends to Discord.
+type RateLimiter interface {
+	// Acquire blocks until a request may be sent on rateLimitPath, a route with the
+	// major parameters filled in and the minor parameters replaced with *.
+	// It returns an error without consuming a request if ctx is done first.
+	// release must be called with the response headers once the request completes, or with
+	// nil headers if the request failed without a response.
+	Acquire(ctx context.Context, rateLimitPath string) (release func(h http.Header) error, err error)
+}
+
+// NewRateLimiter returns a RateLimiter that keeps the rate limits in memory.
+func NewRateLimiter() RateLimiter {
+	return newRateLimiter()
+}
+
 type rateLimiter struct {
 	sync.RWMutex
+	// Keyed by the rate limit path until Discord tells us the bucket of the path.
+	// Then keyed by the bucket and the major parameters of the path.
 	pathRateLimiters map[string]*pathRateLimiter
+	buckets          map[string]string
 	resetAfter       time.Time
 }
 
 func newRateLimiter() *rateLimiter {
 	return &rateLimiter{
 		pathRateLimiters: make(map[string]*pathRateLimiter),
+		buckets:          make(map[string]string),
 	}
 }
 
+func (rl *rateLimiter) Acquire(ctx context.Context, rateLimitPath string) (func(h http.Header) error, error) {
+	var prl *pathRateLimiter
+	for {
+		prl = rl.getPathRateLimiter(rateLimitPath)
+		err := prl.acquire(ctx, rateLimitPath)
+		if err == errPathRemapped {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	return func(h http.Header) error {
+		return rl.release(prl, rateLimitPath, h)
+	}, nil
+}
+
 func (rl *rateLimiter) getPathRateLimiter(path string) *pathRateLimiter {
 	rl.RLock()
-	prl, ok := rl.pathRateLimiters[path]
+	key, ok := rl.buckets[path]
+	rl.RUnlock()
+	if !ok {
+		key = path
+	}
+	return rl.getRateLimiter(key)
+}
+
+func (rl *rateLimiter) getRateLimiter(key string) *pathRateLimiter {
+	rl.RLock()
+	prl, ok := rl.pathRateLimiters[key]
 	rl.RUnlock()
 	if !ok {
 		rl.Lock()
-		prl, ok = rl.pathRateLimiters[path]
+		prl, ok = rl.pathRateLimiters[key]
 		if !ok {
 			prl = &pathRateLimiter{
-				rl: rl,
+				rl:      rl,
+				key:     key,
+				changed: make(chan struct{}),
 			}
-			rl.pathRateLimiters[path] = prl
+			rl.pathRateLimiters[key] = prl
 		}
 		rl.Unlock()
 	}
 	return prl
 }
 
+// release releases prl, which was acquired for path, and learns the bucket of path from h.
+// Different paths can share a bucket so once the bucket is known, the limits are
+// tracked on the bucket instead.
+func (rl *rateLimiter) release(prl *pathRateLimiter, path string, h http.Header) error {
+	err := prl.release(h)
+	if err != nil || h == nil {
+		return err
+	}
+
+	bucket := h.Get("X-RateLimit-Bucket")
+	if bucket == "" {
+		return nil
+	}
+	key := bucket + majorParameters(path)
+	if key == prl.key {
+		return nil
+	}
+
+	rl.Lock()
+	rl.buckets[path] = key
+	rl.Unlock()
+	err = rl.getRateLimiter(key).update(h)
+	// Wakes the requests waiting on prl so that they wait on the bucket instead.
+	prl.mu.Lock()
+	prl.broadcast()
+	prl.mu.Unlock()
+	return err
+}
+
+// majorParameters returns the IDs in path that Discord rate limits separately even
+// when the routes share a bucket.
+func majorParameters(path string) string {
+	var majors string
+	elements := strings.Split(path, "/")
+	for i := 1; i < len(elements); i++ {
+		switch elements[i-1] {
+		case "channels", "guilds", "webhooks":
+			if elements[i] != "*" {
+				majors += ":" + elements[i]
+			}
+		}
+	}
+	return majors
+}
+
 func (rl *rateLimiter) setResetAfter(resetAfter time.Time) {
 	rl.Lock()
 	rl.resetAfter = resetAfter
 	rl.Unlock()
 }
 
-// TODO allow concurrent requests to the same rate limited endpoint
+func (rl *rateLimiter) getResetAfter() time.Time {
+	rl.RLock()
+	defer rl.RUnlock()
+	return rl.resetAfter
+}
+
+// RateLimitError is returned when a request would have to wait for a rate limit
+// to reset past the deadline of its context. The request is never sent.
+type RateLimitError struct {
+	RateLimitPath string
+	ResetAfter    time.Time
+	Global        bool
+}
+
+func (err *RateLimitError) Error() string {
+	if err.Global {
+		return fmt.Sprintf("global rate limit resets at %v, after the context deadline", err.ResetAfter)
+	}
+	return fmt.Sprintf("rate limit for %v resets at %v, after the context deadline", err.RateLimitPath, err.ResetAfter)
+}
+
+// pathRateLimiter admits as many concurrent requests as the last response said remain.
+// While the limits are unknown, e.g. before the first response, only one
+// request is let through at a time.
 type pathRateLimiter struct {
+	key string
+	rl  *rateLimiter
+
 	mu         sync.Mutex
+	limit      int
 	remaining  int
+	inFlight   int
 	resetAfter time.Time
-	rl         *rateLimiter
+	// Closed and replaced whenever a request is released so that waiters can recheck.
+	changed chan struct{}
 }
 
-func (prl *pathRateLimiter) lock() {
-	prl.mu.Lock()
-	now := time.Now()
-	if prl.remaining < 1 && prl.resetAfter.After(now) {
-		time.Sleep(prl.resetAfter.Sub(now))
+// errPathRemapped is returned by acquire when the path has been remapped to its bucket
+// and so has to be acquired on the bucket's pathRateLimiter.
+var errPathRemapped = errors.New("rate limit path remapped to its bucket")
+
+// acquire waits until a request may be sent on the path. If ctx is done or its deadline
+// is before the rate limit resets, it returns an error without consuming a request.
+func (prl *pathRateLimiter) acquire(ctx context.Context, path string) error {
+	for {
+		if prl.rl.getPathRateLimiter(path) != prl {
+			return errPathRemapped
+		}
+
+		err := waitUntil(ctx, prl.rl.getResetAfter(), func(resetAfter time.Time) error {
+			return &RateLimitError{
+				RateLimitPath: path,
+				ResetAfter:    resetAfter,
+				Global:        true,
+			}
+		}, nil)
+		if err != nil {
+			return err
+		}
+
+		prl.mu.Lock()
+		if !prl.resetAfter.IsZero() && !prl.resetAfter.After(time.Now()) {
+			prl.remaining = prl.limit
+			prl.resetAfter = time.Time{}
+		}
+
+		switch {
+		case prl.remaining > 0:
+			prl.remaining--
+			fallthrough
+		case prl.inFlight == 0 && prl.resetAfter.IsZero():
+			prl.inFlight++
+			prl.mu.Unlock()
+			return nil
+		}
+
+		resetAfter := prl.resetAfter
+		changed := prl.changed
+		prl.mu.Unlock()
+
+		err = waitUntil(ctx, resetAfter, func(resetAfter time.Time) error {
+			return &RateLimitError{
+				RateLimitPath: path,
+				ResetAfter:    resetAfter,
+			}
+		}, changed)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// waitUntil blocks until resetAfter, until changed is closed or until ctx is done.
+// A zero resetAfter waits only on changed.
+func waitUntil(ctx context.Context, resetAfter time.Time, deadlineErr func(time.Time) error, changed <-chan struct{}) error {
+	var timerC <-chan time.Time
+	if !resetAfter.IsZero() {
+		d := time.Until(resetAfter)
+		if d <= 0 {
+			return nil
+		}
+		deadline, ok := ctx.Deadline()
+		if ok && deadline.Before(resetAfter) {
+			return deadlineErr(resetAfter)
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timerC = t.C
+	} else if changed == nil {
+		return nil
 	}
-	prl.remaining--
 
-	prl.rl.RLock()
-	now = time.Now()
-	if prl.rl.resetAfter.After(now) {
-		time.Sleep(prl.rl.resetAfter.Sub(now))
+	select {
+	case <-timerC:
+		return nil
+	case <-changed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	prl.rl.RUnlock()
 }
 
-func (prl *pathRateLimiter) unlock(h http.Header) (err error) {
+// release returns the request slot acquired with acquire and updates the limits with
+// the response headers. h is nil if the request failed without a response.
+func (prl *pathRateLimiter) release(h http.Header) error {
+	prl.mu.Lock()
 	defer prl.mu.Unlock()
+	defer prl.broadcast()
 
+	prl.inFlight--
 	if h == nil {
 		return nil
 	}
+	return prl.updateLocked(h)
+}
 
-	globalHeader := h.Get("X-RateLimit-Global")
+// update updates the limits with the response headers of a request that was
+// acquired on another pathRateLimiter.
+func (prl *pathRateLimiter) update(h http.Header) error {
+	prl.mu.Lock()
+	defer prl.mu.Unlock()
+	defer prl.broadcast()
+	return prl.updateLocked(h)
+}
+
+func (prl *pathRateLimiter) updateLocked(h http.Header) error {
+	if h.Get("X-RateLimit-Global") != "" {
+		retryAfter, err := parseRetryAfter(h)
+		if err != nil {
+			return err
+		}
+		prl.rl.setResetAfter(time.Now().Add(retryAfter))
+		return nil
+	}
+
+	remainingHeader := h.Get("X-RateLimit-Remaining")
 	resetHeader := h.Get("X-RateLimit-Reset")
+	if remainingHeader == "" || resetHeader == "" {
+		// Route is not rate limited.
+		prl.limit = math.MaxInt32
+		prl.remaining = math.MaxInt32
+		prl.resetAfter = time.Time{}
+		return nil
+	}
 
-	if globalHeader != "" {
-		retryAfterHeader := h.Get("Retry-After")
-		var parsedRetryAfter int64
-		parsedRetryAfter, err = strconv.ParseInt(retryAfterHeader, 10, 64)
+	remaining, err := strconv.Atoi(remainingHeader)
+	if err != nil {
+		return err
+	}
+	resetAfter, err := parseReset(resetHeader)
+	if err != nil {
+		return err
+	}
+	limitHeader := h.Get("X-RateLimit-Limit")
+	if limitHeader != "" {
+		prl.limit, err = strconv.Atoi(limitHeader)
 		if err != nil {
 			return err
 		}
-		retryAfter := time.Now().Add(time.Duration(parsedRetryAfter) * time.Millisecond)
-		prl.rl.setResetAfter(retryAfter)
-	} else if resetHeader != "" {
-		var parsedResetAfter int64
-		parsedResetAfter, err = strconv.ParseInt(resetHeader, 10, 64)
+	} else if prl.limit < remaining+1 {
+		prl.limit = remaining + 1
+	}
+
+	if h.Get("Retry-After") != "" {
+		// We were rate limited anyway, most likely by another client using the same token.
+		retryAfter, err := parseRetryAfter(h)
 		if err != nil {
 			return err
 		}
-		prl.resetAfter = time.Unix(parsedResetAfter, 0)
+		remaining = 0
+		resetAfter = time.Now().Add(retryAfter)
 	}
 
-	remainingHeader := h.Get("X-RateLimit-Remaining")
-	if remainingHeader != "" {
-		prl.remaining, err = strconv.Atoi(remainingHeader)
+	if !resetAfter.After(time.Now()) {
+		// Response from a window that has already reset.
+		return nil
 	}
 
-	return err
+	// The requests still in flight were let through from our remaining count but
+	// may not have been counted by Discord yet.
+	remaining -= prl.inFlight
+	if remaining < 0 {
+		remaining = 0
+	}
+	if resetAfter.After(prl.resetAfter) {
+		// New rate limit window.
+		prl.resetAfter = resetAfter
+		prl.remaining = remaining
+	} else if remaining < prl.remaining {
+		// Responses can arrive out of order so only trust the smaller count.
+		prl.remaining = remaining
+	}
+
+	return nil
+}
+
+func (prl *pathRateLimiter) broadcast() {
+	close(prl.changed)
+	prl.changed = make(chan struct{})
+}
+
+func parseReset(resetHeader string) (time.Time, error) {
+	reset, err := strconv.ParseFloat(resetHeader, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec, frac := math.Modf(reset)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+}
+
+func parseRetryAfter(h http.Header) (time.Duration, error) {
+	retryAfter, err := strconv.ParseInt(h.Get("Retry-After"), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	// Rounded up as Discord truncates it to milliseconds, retrying after the truncated
+	// duration can be rate limited again.
+	return time.Duration(retryAfter+1) * time.Millisecond, nil
 }
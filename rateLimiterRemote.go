@@ -0,0 +1,371 @@
+package discgo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitCoordinator shares the rate limits of a single token between processes.
+// Each process dials it with DialRateLimiter and uses the returned RemoteRateLimiter
+// as the RateLimiter of its RESTClient.
+type RateLimitCoordinator struct {
+	rl *rateLimiter
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+}
+
+func NewRateLimitCoordinator() *RateLimitCoordinator {
+	return &RateLimitCoordinator{
+		rl:        newRateLimiter(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+var errCoordinatorClosed = errors.New("rate limit coordinator closed")
+
+// Serve accepts connections from RemoteRateLimiters on l until l or the coordinator is closed.
+func (rlc *RateLimitCoordinator) Serve(l net.Listener) error {
+	rlc.mu.Lock()
+	if rlc.closed {
+		rlc.mu.Unlock()
+		return errCoordinatorClosed
+	}
+	rlc.listeners[l] = struct{}{}
+	rlc.mu.Unlock()
+
+	defer func() {
+		rlc.mu.Lock()
+		delete(rlc.listeners, l)
+		rlc.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			rlc.mu.Lock()
+			closed := rlc.closed
+			rlc.mu.Unlock()
+			if closed {
+				return errCoordinatorClosed
+			}
+			return err
+		}
+
+		rlc.mu.Lock()
+		if rlc.closed {
+			rlc.mu.Unlock()
+			conn.Close()
+			return errCoordinatorClosed
+		}
+		rlc.conns[conn] = struct{}{}
+		rlc.mu.Unlock()
+
+		go rlc.serveConn(conn)
+	}
+}
+
+// Close closes all listeners and connections.
+func (rlc *RateLimitCoordinator) Close() error {
+	rlc.mu.Lock()
+	defer rlc.mu.Unlock()
+	rlc.closed = true
+	var err error
+	for l := range rlc.listeners {
+		cerr := l.Close()
+		if err == nil {
+			err = cerr
+		}
+	}
+	for conn := range rlc.conns {
+		cerr := conn.Close()
+		if err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+const (
+	rateLimitOpAcquire = "acquire"
+	rateLimitOpCancel  = "cancel"
+	rateLimitOpRelease = "release"
+)
+
+type rateLimitMessage struct {
+	ID       uint64      `json:"id"`
+	Op       string      `json:"op,omitempty"`
+	Path     string      `json:"path,omitempty"`
+	Deadline *time.Time  `json:"deadline,omitempty"`
+	Header   http.Header `json:"header,omitempty"`
+
+	// Set on the response to an acquire.
+	Err          string          `json:"err,omitempty"`
+	RateLimitErr *RateLimitError `json:"rate_limit_err,omitempty"`
+}
+
+func (rlc *RateLimitCoordinator) serveConn(conn net.Conn) {
+	var (
+		mu       sync.Mutex
+		cancels  = make(map[uint64]context.CancelFunc)
+		releases = make(map[uint64]func(http.Header) error)
+		wg       sync.WaitGroup
+
+		writeMu sync.Mutex
+		enc     = json.NewEncoder(conn)
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	defer func() {
+		cancel()
+		wg.Wait()
+		// The process is gone so it will never release what it acquired.
+		for _, release := range releases {
+			release(nil)
+		}
+
+		rlc.mu.Lock()
+		delete(rlc.conns, conn)
+		rlc.mu.Unlock()
+		conn.Close()
+	}()
+
+	dec := json.NewDecoder(conn)
+	for {
+		var m rateLimitMessage
+		err := dec.Decode(&m)
+		if err != nil {
+			return
+		}
+
+		switch m.Op {
+		case rateLimitOpAcquire:
+			var actx context.Context
+			var acancel context.CancelFunc
+			if m.Deadline != nil {
+				actx, acancel = context.WithDeadline(ctx, *m.Deadline)
+			} else {
+				actx, acancel = context.WithCancel(ctx)
+			}
+			mu.Lock()
+			cancels[m.ID] = acancel
+			mu.Unlock()
+
+			wg.Add(1)
+			go func(m rateLimitMessage) {
+				defer wg.Done()
+
+				release, err := rlc.rl.Acquire(actx, m.Path)
+				acancel()
+
+				resp := &rateLimitMessage{ID: m.ID}
+				mu.Lock()
+				delete(cancels, m.ID)
+				if err == nil {
+					releases[m.ID] = release
+				}
+				mu.Unlock()
+				if err != nil {
+					if rlErr, ok := err.(*RateLimitError); ok {
+						resp.RateLimitErr = rlErr
+					} else {
+						resp.Err = err.Error()
+					}
+				}
+
+				writeMu.Lock()
+				enc.Encode(resp)
+				writeMu.Unlock()
+			}(m)
+		case rateLimitOpCancel:
+			mu.Lock()
+			acancel, ok := cancels[m.ID]
+			mu.Unlock()
+			if ok {
+				acancel()
+			}
+		case rateLimitOpRelease:
+			mu.Lock()
+			release, ok := releases[m.ID]
+			delete(releases, m.ID)
+			mu.Unlock()
+			if ok {
+				// There is no one to return the error to. The next response will have
+				// the correct headers anyway.
+				_ = release(m.Header)
+			}
+		}
+	}
+}
+
+// RemoteRateLimiter is a RateLimiter that acquires from a RateLimitCoordinator.
+type RemoteRateLimiter struct {
+	conn net.Conn
+
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *rateLimitMessage
+
+	closed chan struct{}
+	err    error
+}
+
+// DialRateLimiter connects to the RateLimitCoordinator listening on the given address.
+// See net.Dial for the network and address formats, e.g. "unix" and "/tmp/discgo.sock".
+func DialRateLimiter(network, address string) (*RemoteRateLimiter, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	rrl := &RemoteRateLimiter{
+		conn:    conn,
+		enc:     json.NewEncoder(conn),
+		pending: make(map[uint64]chan *rateLimitMessage),
+		closed:  make(chan struct{}),
+	}
+	go rrl.readLoop()
+	return rrl, nil
+}
+
+var errRemoteRateLimiterClosed = errors.New("remote rate limiter closed")
+
+func (rrl *RemoteRateLimiter) readLoop() {
+	dec := json.NewDecoder(rrl.conn)
+	for {
+		var m rateLimitMessage
+		err := dec.Decode(&m)
+		if err != nil {
+			rrl.mu.Lock()
+			if rrl.err == nil {
+				rrl.err = err
+			}
+			rrl.mu.Unlock()
+			close(rrl.closed)
+			return
+		}
+
+		rrl.mu.Lock()
+		ch, ok := rrl.pending[m.ID]
+		delete(rrl.pending, m.ID)
+		rrl.mu.Unlock()
+		if ok {
+			ch <- &m
+		}
+	}
+}
+
+func (rrl *RemoteRateLimiter) write(m *rateLimitMessage) error {
+	rrl.writeMu.Lock()
+	defer rrl.writeMu.Unlock()
+	return rrl.enc.Encode(m)
+}
+
+func (rrl *RemoteRateLimiter) closedErr() error {
+	rrl.mu.Lock()
+	defer rrl.mu.Unlock()
+	return rrl.err
+}
+
+func (rrl *RemoteRateLimiter) Acquire(ctx context.Context, rateLimitPath string) (func(h http.Header) error, error) {
+	ch := make(chan *rateLimitMessage, 1)
+	rrl.mu.Lock()
+	rrl.nextID++
+	id := rrl.nextID
+	rrl.pending[id] = ch
+	rrl.mu.Unlock()
+
+	m := &rateLimitMessage{
+		ID:   id,
+		Op:   rateLimitOpAcquire,
+		Path: rateLimitPath,
+	}
+	deadline, ok := ctx.Deadline()
+	if ok {
+		m.Deadline = &deadline
+	}
+	err := rrl.write(m)
+	if err != nil {
+		rrl.mu.Lock()
+		delete(rrl.pending, id)
+		rrl.mu.Unlock()
+		return nil, err
+	}
+
+	release := func(h http.Header) error {
+		return rrl.write(&rateLimitMessage{
+			ID:     id,
+			Op:     rateLimitOpRelease,
+			Header: rateLimitHeaders(h),
+		})
+	}
+
+	var resp *rateLimitMessage
+	select {
+	case resp = <-ch:
+	case <-rrl.closed:
+		return nil, rrl.closedErr()
+	case <-ctx.Done():
+		err = rrl.write(&rateLimitMessage{ID: id, Op: rateLimitOpCancel})
+		if err != nil {
+			return nil, ctx.Err()
+		}
+		// Wait for the coordinator to acknowledge the cancellation. It may have
+		// already acquired for us in which case we give it back.
+		select {
+		case resp = <-ch:
+			if resp.Err == "" && resp.RateLimitErr == nil {
+				release(nil)
+			}
+		case <-rrl.closed:
+		}
+		return nil, ctx.Err()
+	}
+
+	if resp.RateLimitErr != nil {
+		return nil, resp.RateLimitErr
+	}
+	if resp.Err != "" {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.New(resp.Err)
+	}
+	return release, nil
+}
+
+// rateLimitHeaders returns only the headers the coordinator needs.
+func rateLimitHeaders(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	h2 := make(http.Header)
+	for k, v := range h {
+		if strings.HasPrefix(k, "X-Ratelimit-") || k == "Retry-After" {
+			h2[k] = v
+		}
+	}
+	return h2
+}
+
+// Close closes the connection to the coordinator. The coordinator releases everything
+// that was acquired and not yet released.
+func (rrl *RemoteRateLimiter) Close() error {
+	rrl.mu.Lock()
+	if rrl.err == nil {
+		rrl.err = errRemoteRateLimiterClosed
+	}
+	rrl.mu.Unlock()
+	return rrl.conn.Close()
+}
@@ -0,0 +1,97 @@
+package discgo
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestRateLimitCoordinator(t *testing.T) (addr string) {
+	addr = filepath.Join(t.TempDir(), "discgo.sock")
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rlc := NewRateLimitCoordinator()
+	go rlc.Serve(l)
+	t.Cleanup(func() {
+		rlc.Close()
+	})
+	return addr
+}
+
+func dialTestRateLimiter(t *testing.T, addr string) *RemoteRateLimiter {
+	rrl, err := DialRateLimiter("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		rrl.Close()
+	})
+	return rrl
+}
+
+func TestRemoteRateLimiter_Shared(t *testing.T) {
+	addr := newTestRateLimitCoordinator(t)
+	rrl1 := dialTestRateLimiter(t, addr)
+	rrl2 := dialTestRateLimiter(t, addr)
+
+	path := "/channels/1/messages"
+	release, err := rrl1.Acquire(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = release(rateLimitHeader(5, 0, time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shortCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	_, err = rrl2.Acquire(shortCtx, path)
+	rlErr, ok := err.(*RateLimitError)
+	if !ok {
+		t.Fatalf("expected error to be of type *discgo.RateLimitError but got %v", err)
+	}
+	if rlErr.RateLimitPath != path {
+		t.Fatalf("expected %v but got %v", path, rlErr.RateLimitPath)
+	}
+}
+
+func TestRemoteRateLimiter_Cancel(t *testing.T) {
+	addr := newTestRateLimitCoordinator(t)
+	rrl1 := dialTestRateLimiter(t, addr)
+	rrl2 := dialTestRateLimiter(t, addr)
+
+	path := "/channels/1/messages"
+	_, err := rrl1.Acquire(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Limits are unknown so rrl2 has to wait on the request of rrl1.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err = rrl2.Acquire(cancelCtx, path)
+	if err != context.Canceled {
+		t.Fatalf("expected %v but got %v", context.Canceled, err)
+	}
+
+	// Closing rrl1 releases its request.
+	done := make(chan error, 1)
+	go func() {
+		_, err := rrl2.Acquire(ctx, path)
+		done <- err
+	}()
+	rrl1.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the request of the closed rate limiter to be released")
+	}
+}
@@ -0,0 +1,223 @@
+package discgo
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPathRateLimiter_AcquireCancelled(t *testing.T) {
+	rl := newRateLimiter()
+	prl := rl.getPathRateLimiter("/channels/1/messages")
+	prl.resetAfter = time.Now().Add(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	err := prl.acquire(ctx, "/channels/1/messages")
+	if err != context.Canceled {
+		t.Fatalf("expected %v but got %v", context.Canceled, err)
+	}
+	if prl.inFlight != 0 {
+		t.Fatalf("expected %v requests in flight but got %v", 0, prl.inFlight)
+	}
+}
+
+func TestPathRateLimiter_AcquireDeadline(t *testing.T) {
+	rl := newRateLimiter()
+	prl := rl.getPathRateLimiter("/channels/1/messages")
+	rl.setResetAfter(time.Now().Add(time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err := prl.acquire(ctx, "/channels/1/messages")
+	rlErr, ok := err.(*RateLimitError)
+	if !ok {
+		t.Fatalf("expected error to be of type *discgo.RateLimitError but got %v", err)
+	}
+	if !rlErr.Global {
+		t.Fatal("expected global rate limit error")
+	}
+	if prl.inFlight != 0 {
+		t.Fatalf("expected %v requests in flight but got %v", 0, prl.inFlight)
+	}
+}
+
+func rateLimitHeader(limit, remaining int, reset time.Time) http.Header {
+	h := make(http.Header)
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	return h
+}
+
+func TestPathRateLimiter_Concurrent(t *testing.T) {
+	rl := newRateLimiter()
+	prl := rl.getPathRateLimiter("/channels/1/messages")
+
+	// Limits are unknown so only one request should be let through.
+	err := prl.acquire(ctx, "/channels/1/messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shortCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	err = prl.acquire(shortCtx, "/channels/1/messages")
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	err = prl.release(rateLimitHeader(5, 4, time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		err = prl.acquire(ctx, "/channels/1/messages")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if prl.inFlight != 4 {
+		t.Fatalf("expected %v requests in flight but got %v", 4, prl.inFlight)
+	}
+
+	shortCtx, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+	err = prl.acquire(shortCtx, "/channels/1/messages")
+	cancel()
+	if _, ok := err.(*RateLimitError); !ok {
+		t.Fatalf("expected error to be of type *discgo.RateLimitError but got %v", err)
+	}
+}
+
+func TestPathRateLimiter_Reset(t *testing.T) {
+	rl := newRateLimiter()
+	prl := rl.getPathRateLimiter("/channels/1/messages")
+
+	err := prl.acquire(ctx, "/channels/1/messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = prl.release(rateLimitHeader(2, 0, time.Now().Add(2*time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		err = prl.acquire(ctx, "/channels/1/messages")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatal("waited more than one reset")
+	}
+
+	// Window reset without a response yet, the third has to wait for one.
+	done := make(chan error, 1)
+	go func() {
+		done <- prl.acquire(ctx, "/channels/1/messages")
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("expected acquire to block but got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	err = prl.release(rateLimitHeader(2, 0, time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("expected acquire to block but got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestRateLimiter_SharedBucket(t *testing.T) {
+	rl := newRateLimiter()
+	path1 := "/channels/1/messages/*"
+	path2 := "/channels/1/pins/*"
+
+	prl1 := rl.getPathRateLimiter(path1)
+	err := prl1.acquire(ctx, path1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := rateLimitHeader(5, 0, time.Now().Add(time.Hour))
+	h.Set("X-RateLimit-Bucket", "abcd")
+	err = rl.release(prl1, path1, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prl2 := rl.getPathRateLimiter(path2)
+	err = prl2.acquire(ctx, path2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.release(prl2, path2, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prl1 = rl.getPathRateLimiter(path1)
+	prl2 = rl.getPathRateLimiter(path2)
+	if prl1 != prl2 {
+		t.Fatalf("expected %v and %v to share a rate limiter", path1, path2)
+	}
+
+	shortCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err = prl2.acquire(shortCtx, path2)
+	if _, ok := err.(*RateLimitError); !ok {
+		t.Fatalf("expected error to be of type *discgo.RateLimitError but got %v", err)
+	}
+
+	prl3 := rl.getPathRateLimiter("/channels/2/messages/*")
+	if prl3 == prl1 {
+		t.Fatal("expected different major parameters to not share a rate limiter")
+	}
+}
+
+func TestRateLimiter_RemapWaiters(t *testing.T) {
+	rl := newRateLimiter()
+	path := "/channels/1/messages/*"
+
+	release, err := rl.Acquire(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Waits on the path's rate limiter as only one request is let through
+	// until the limits are known.
+	waited := make(chan error, 1)
+	go func() {
+		_, err := rl.Acquire(ctx, path)
+		waited <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	h := rateLimitHeader(2, 1, time.Now().Add(time.Hour))
+	h.Set("X-RateLimit-Bucket", "abcd")
+	err = release(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err = <-waited:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected waiting request to be let through")
+	}
+
+	// The waiting request used the bucket's last remaining request.
+	shortCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = rl.Acquire(shortCtx, path)
+	if _, ok := err.(*RateLimitError); !ok {
+		t.Fatalf("expected error to be of type *discgo.RateLimitError but got %v", err)
+	}
+}
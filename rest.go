@@ -10,24 +10,56 @@ import (
 	"bytes"
 
 	"context"
+	"strings"
+	"sync"
 	"time"
 )
 
 type RESTClient struct {
 	Token      string
 	HttpClient *http.Client
+	// Defaults to DefaultBaseURL. Set it to use a proxy or a test server.
+	BaseURL string
+	// Defaults to DefaultAPIVersion.
+	APIVersion string
+	// Defaults to DefaultCDNURL.
+	CDNURL string
+	// Defaults to an in memory RateLimiter. Set it to share rate limits between processes.
+	RateLimiter RateLimiter
+	// Defaults to DefaultRetryPolicy.
+	RetryPolicy *RetryPolicy
+	// Wrap every attempt of every request, the first is the outermost.
+	// Must be set before the first request.
+	Middlewares []Middleware
 
-	rl *rateLimiter
+	initOnce  sync.Once
+	roundTrip RoundTripFunc
 }
 
 const (
-	apiVersion  = "6"
-	endpointAPI = "https://discordapp.com/api/v" + apiVersion
-	Version     = "0.1.0"
+	DefaultAPIVersion = "6"
+	DefaultBaseURL    = "https://discordapp.com/api"
+	DefaultCDNURL     = "https://cdn.discordapp.com"
+	Version           = "0.1.0"
 )
 
 func (c *RESTClient) rootEndpoint() *endpoint {
-	return &endpoint{c: c, url: endpointAPI}
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	apiVersion := c.APIVersion
+	if apiVersion == "" {
+		apiVersion = DefaultAPIVersion
+	}
+	return &endpoint{c: c, url: strings.TrimSuffix(baseURL, "/") + "/v" + apiVersion}
+}
+
+func (c *RESTClient) cdnURL() string {
+	if c.CDNURL == "" {
+		return DefaultCDNURL
+	}
+	return strings.TrimSuffix(c.CDNURL, "/")
 }
 
 var userAgent = fmt.Sprintf("DiscordBot (https://github.com/nhooyr/discgo, %v)", Version)
@@ -43,40 +75,77 @@ func (c *RESTClient) newRequest(ctx context.Context, method, url string, body io
 }
 
 func (c *RESTClient) do(req *http.Request, rateLimitPath string) ([]byte, error) {
-	if c.rl == nil {
-		c.rl = newRateLimiter()
+	c.initOnce.Do(func() {
+		if c.RateLimiter == nil {
+			c.RateLimiter = NewRateLimiter()
+		}
 		if c.HttpClient == nil {
 			c.HttpClient = &http.Client{Timeout: 20 * time.Second}
 		}
+		c.roundTrip = func(ri *RequestInfo) (*http.Response, error) {
+			return c.HttpClient.Do(ri.Request)
+		}
+		for i := len(c.Middlewares) - 1; i >= 0; i-- {
+			c.roundTrip = c.Middlewares[i](c.roundTrip)
+		}
+	})
+
+	rp := c.RetryPolicy
+	if rp == nil {
+		rp = DefaultRetryPolicy
+	}
+	for attempt := 1; ; attempt++ {
+		body, err := c.doOnce(req, rateLimitPath, attempt)
+		if err == nil {
+			return body, nil
+		}
+		if attempt >= rp.MaxAttempts || req.Context().Err() != nil {
+			return nil, err
+		}
+
+		retry, backoff := rp.shouldRetry(req, err)
+		if !retry {
+			return nil, err
+		}
+		if backoff {
+			err = rp.backoff(req.Context(), attempt)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		req, err = rewindRequest(req)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return c.doN(req, rateLimitPath, 0)
 }
 
-// TODO exponential backoff maybe? or too much in this library? not sure.
-func (c *RESTClient) doN(req *http.Request, rateLimitPath string, n int) ([]byte, error) {
-	prl := c.rl.getPathRateLimiter(rateLimitPath)
-	prl.lock()
-	resp, err := c.HttpClient.Do(req)
+func (c *RESTClient) doOnce(req *http.Request, rateLimitPath string, attempt int) (body []byte, err error) {
+	release, err := c.RateLimiter.Acquire(req.Context(), rateLimitPath)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.roundTrip(&RequestInfo{
+		Request:       req,
+		RateLimitPath: rateLimitPath,
+		Attempt:       attempt,
+	})
 	if err != nil {
-		prl.unlock(nil)
+		release(nil)
 		return nil, err
 	}
 	defer safeClose(resp.Body.Close, &err)
-	err = prl.unlock(resp.Header)
+	err = release(resp.Header)
 	if err != nil {
 		return nil, err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 	switch resp.StatusCode {
 	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
-	case http.StatusBadGateway:
-		return c.doN(req, rateLimitPath, n+1)
-	case http.StatusTooManyRequests:
-		// Do not increment n because the next request should always be tried.
-		return c.doN(req, rateLimitPath, n)
 	default:
 		apiErr := &APIError{
 			Request:  req,
@@ -100,8 +169,44 @@ func safeClose(closeFunc func() error, err *error) {
 }
 
 type APIErrorJSON struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Set when the request body was invalid.
+	Errors *FieldErrors `json:"errors"`
+}
+
+func (errJSON *APIErrorJSON) UnmarshalJSON(b []byte) error {
+	type apiErrorJSON APIErrorJSON
+	err := json.Unmarshal(b, (*apiErrorJSON)(errJSON))
+	if err != nil {
+		return err
+	}
+	if errJSON.Errors != nil {
+		return nil
+	}
+
+	// Older routes return the invalid fields at the top level of the body.
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return err
+	}
+	delete(fields, "code")
+	delete(fields, "message")
+	delete(fields, "errors")
+	for k, v := range fields {
+		fe := new(FieldErrors)
+		err = json.Unmarshal(v, fe)
+		if err != nil {
+			// Not a field error.
+			continue
+		}
+		if errJSON.Errors == nil {
+			errJSON.Errors = &FieldErrors{Fields: make(map[string]*FieldErrors)}
+		}
+		errJSON.Errors.Fields[k] = fe
+	}
+	return nil
 }
 
 type APIError struct {
@@ -117,7 +222,16 @@ func (err *APIError) Error() string {
 		code := err.Response.StatusCode
 		return fmt.Sprintf("Unexpected response %v %v, body: %q", code, http.StatusText(code), err.Body)
 	}
-	return fmt.Sprintf("Error code: %v, message: %v", err.JSON.Code, err.JSON.Message)
+	if err.JSON.Errors != nil {
+		return fmt.Sprintf("Error code: %v, message: %v, errors: %v", int(err.JSON.Code), err.JSON.Message, err.JSON.Errors)
+	}
+	return fmt.Sprintf("Error code: %v, message: %v", int(err.JSON.Code), err.JSON.Message)
+}
+
+// Is reports whether target is the ErrorCode of the error.
+func (err *APIError) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	return ok && err.JSON != nil && err.JSON.Code == code
 }
 
 type endpoint struct {
@@ -158,7 +272,8 @@ func (e *endpoint) newRequestJSON(ctx context.Context, method string, v interfac
 
 func (e *endpoint) do(req *http.Request, v interface{}) error {
 	respBody, err := e.c.do(req, e.rateLimitPath)
-	if err != nil || v == nil {
+	// 204 responses have no body.
+	if err != nil || v == nil || len(respBody) == 0 {
 		return err
 	}
 	return json.Unmarshal(respBody, v)
@@ -2,20 +2,69 @@ package discgo
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/nhooyr/discgo/discgotest"
 )
 
 var (
-	client = &RESTClient{
-		Token: os.Getenv("DISCORD_TOKEN"),
-	}
-	ctx = context.TODO()
+	client = new(RESTClient)
+	ctx    = context.TODO()
+	srv    *discgotest.Server
 )
 
+func TestMain(m *testing.M) {
+	srv = discgotest.NewServer("token")
+	seed(srv)
+	client.Token = srv.Token
+	client.BaseURL = srv.URL
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
+
+// seed adds what the tests expect to exist.
+func seed(srv *discgotest.Server) {
+	// Allow every test to run without being rate limited.
+	srv.SetRateLimit(discgotest.RateLimit{Limit: 1000, Window: time.Minute})
+
+	srv.AddGuild(&discgotest.Guild{ID: gID, Name: "discgo"})
+	srv.AddMember(gID, &discgotest.Member{
+		User: &discgotest.User{ID: uID, Username: "nhooyr", Discriminator: "4567"},
+	})
+	for i, name := range []string{"general", "bots", "random", "memes"} {
+		ch := &discgotest.Channel{GuildID: gID, Name: name, Position: i}
+		if i == 0 {
+			ch.ID = cID
+		}
+		srv.AddChannel(ch)
+	}
+	srv.AddMessage(&discgotest.Message{ID: mID, ChannelID: cID, Content: "boar"})
+	srv.AddReaction(cID, mID, emoji, uID)
+	for i := 0; i < 5; i++ {
+		srv.AddMessage(&discgotest.Message{ChannelID: cID, Content: "heads"})
+	}
+	srv.AddInvite(&discgotest.Invite{
+		Code:    inviteCode,
+		Guild:   &discgotest.InviteGuild{ID: gID, Name: "discgo"},
+		Channel: &discgotest.InviteChannel{ID: cID, Name: "general"},
+	})
+}
+
 func TestClient_APIError(t *testing.T) {
-	c := new(RESTClient)
+	c := &RESTClient{BaseURL: srv.URL}
 	_, err := c.Me().Connections().Get(ctx)
 	if err == nil {
 		t.Fatal("expected non nil error")
@@ -37,3 +86,239 @@ func TestClient_APIError(t *testing.T) {
 		t.Fatalf("expected %v but got %v", 0, apiErr.JSON.Message)
 	}
 }
+
+func TestClient_RateLimit(t *testing.T) {
+	srv := discgotest.NewServer("token")
+	defer srv.Close()
+	srv.SetRateLimit(discgotest.RateLimit{Limit: 2, Window: time.Second})
+	ch := srv.AddChannel(&discgotest.Channel{Name: "general"})
+
+	c := &RESTClient{
+		Token:   srv.Token,
+		BaseURL: srv.URL,
+	}
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		_, err := c.Channel(ch.ID).Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if srv.RateLimited() != 0 {
+		t.Fatalf("expected %v but got %v 429s", 0, srv.RateLimited())
+	}
+	if time.Since(start) < time.Second {
+		t.Fatalf("expected the client to wait for the window to reset")
+	}
+}
+
+func TestClient_RateLimitShared(t *testing.T) {
+	srv := discgotest.NewServer("token")
+	defer srv.Close()
+	srv.SetRateLimit(discgotest.RateLimit{Limit: 1, Window: time.Second})
+	ch := srv.AddChannel(&discgotest.Channel{Name: "general"})
+
+	// Another client using the same token, e.g. another process, gets rate limited.
+	c1 := &RESTClient{Token: srv.Token, BaseURL: srv.URL}
+	c2 := &RESTClient{Token: srv.Token, BaseURL: srv.URL}
+	_, err := c1.Channel(ch.ID).Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c2.Channel(ch.ID).Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.RateLimited() != 1 {
+		t.Fatalf("expected %v but got %v 429s", 1, srv.RateLimited())
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil {
+			t.Error(err)
+		}
+		if r.FormValue("payload_json") != `{"content":"boar"}` {
+			t.Errorf("unexpected payload_json %q on attempt %v", r.FormValue("payload_json"), attempts)
+		}
+		if attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"content":"boar"}`))
+	}))
+	defer srv.Close()
+
+	c := &RESTClient{
+		RetryPolicy: &RetryPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   time.Millisecond,
+			MaxDelay:    time.Millisecond,
+			StatusCodes: []int{http.StatusBadGateway},
+		},
+	}
+	e := EndpointMessages{&endpoint{c: c, url: srv.URL}}
+	m, err := e.Create(ctx, &ParamsMessageCreate{Content: "boar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Content != "boar" {
+		t.Fatalf("expected %q but got %q", "boar", m.Content)
+	}
+
+	attempts = -10
+	_, err = e.Create(ctx, &ParamsMessageCreate{Content: "boar"})
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatalf("expected error to be of type *discgo.APIError but got %v", err)
+	}
+	if apiErr.Response.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected %v but got %v", http.StatusBadGateway, apiErr.Response.StatusCode)
+	}
+	if attempts != -7 {
+		t.Fatalf("expected %v attempts but got %v", 3, attempts+10)
+	}
+}
+
+func TestRetryPolicy_MaxDelay(t *testing.T) {
+	testCases := []struct {
+		rp       *RetryPolicy
+		attempt  int
+		expected time.Duration
+	}{
+		{&RetryPolicy{BaseDelay: time.Second}, 1, time.Second},
+		{&RetryPolicy{BaseDelay: time.Second}, 3, 4 * time.Second},
+		{&RetryPolicy{BaseDelay: time.Second}, 100, math.MaxInt64},
+		{DefaultRetryPolicy, 2, 200 * time.Millisecond},
+		{DefaultRetryPolicy, 7, 5 * time.Second},
+	}
+	for _, tc := range testCases {
+		d := tc.rp.maxDelay(tc.attempt)
+		if d != tc.expected {
+			t.Fatalf("expected %v but got %v for attempt %v of %+v", tc.expected, d, tc.attempt, tc.rp)
+		}
+	}
+}
+
+func TestIsNetworkError(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Post", URL: "https://discordapp.com", Err: err}
+	}
+	testCases := []struct {
+		err      error
+		expected bool
+	}{
+		{urlErr(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), true},
+		{urlErr(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), true},
+		{urlErr(&net.DNSError{IsTimeout: true}), true},
+		{urlErr(io.ErrUnexpectedEOF), true},
+		{urlErr(x509.UnknownAuthorityError{}), false},
+		{urlErr(errors.New("unsupported protocol scheme \"\"")), false},
+		{errors.New("owl"), false},
+	}
+	for _, tc := range testCases {
+		if IsNetworkError(tc.err) != tc.expected {
+			t.Fatalf("expected %v for %v", tc.expected, tc.err)
+		}
+	}
+
+	reset := urlErr(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)})
+	post := httptest.NewRequest(http.MethodPost, "/", nil)
+	if retry, _ := DefaultRetryPolicy.shouldRetry(post, reset); retry {
+		t.Fatal("expected POST to not be retried")
+	}
+	get := httptest.NewRequest(http.MethodGet, "/", nil)
+	if retry, _ := DefaultRetryPolicy.shouldRetry(get, reset); !retry {
+		t.Fatal("expected GET to be retried")
+	}
+	rp := *DefaultRetryPolicy
+	rp.RetryNonIdempotent = true
+	if retry, _ := rp.shouldRetry(post, reset); !retry {
+		t.Fatal("expected POST to be retried")
+	}
+}
+
+func TestClient_APIErrorFields(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{
+			"code": 50035,
+			"message": "Invalid Form Body",
+			"errors": {
+				"name": {"_errors": [{"code": "BASE_TYPE_BAD_LENGTH", "message": "Must be between 2 and 100 in length."}]},
+				"roles": {"0": {"id": {"_errors": [{"code": "BASE_TYPE_REQUIRED", "message": "This field is required"}]}}}
+			}
+		}`))
+	}))
+	defer srv.Close()
+
+	e := EndpointGuild{&endpoint{c: new(RESTClient), url: srv.URL}}
+	_, err := e.Modify(ctx, &ParamsGuildModify{Name: "a"})
+	if !errors.Is(err, ErrorCodeInvalidFormBody) {
+		t.Fatalf("expected %v but got %v", ErrorCodeInvalidFormBody, err)
+	}
+	if errors.Is(err, ErrorCodeMissingPermissions) {
+		t.Fatalf("expected %v to not be %v", err, ErrorCodeMissingPermissions)
+	}
+
+	fieldErrs := err.(*APIError).JSON.Errors.Flatten()
+	if len(fieldErrs) != 2 {
+		t.Fatalf("expected %v fields but got %v", 2, len(fieldErrs))
+	}
+	if fieldErrs["name"][0].Code != "BASE_TYPE_BAD_LENGTH" {
+		t.Fatalf("expected %v but got %v", "BASE_TYPE_BAD_LENGTH", fieldErrs["name"][0].Code)
+	}
+	if fieldErrs["roles.0.id"][0].Message != "This field is required" {
+		t.Fatalf("expected %v but got %v", "This field is required", fieldErrs["roles.0.id"][0].Message)
+	}
+}
+
+func TestClient_APIErrorTopLevelFields(t *testing.T) {
+	var errJSON APIErrorJSON
+	err := json.Unmarshal([]byte(`{"content": ["Must be 2000 or fewer in length."]}`), &errJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldErrs := errJSON.Errors.Flatten()
+	if fieldErrs["content"][0].Message != "Must be 2000 or fewer in length." {
+		t.Fatalf("expected %v but got %v", "Must be 2000 or fewer in length.", fieldErrs["content"][0].Message)
+	}
+}
+
+func TestClient_BaseURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v9/users/@me" {
+			t.Errorf("unexpected path %v", r.URL.Path)
+		}
+		w.Write([]byte(`{"id":"1","username":"boar"}`))
+	}))
+	defer srv.Close()
+
+	c := &RESTClient{
+		BaseURL:    srv.URL + "/api/",
+		APIVersion: "9",
+		CDNURL:     "http://cdn.local",
+	}
+	u, err := c.Me().Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Username != "boar" {
+		t.Fatalf("expected %v but got %v", "boar", u.Username)
+	}
+
+	expected := "http://cdn.local/avatars/1/a_b.gif"
+	avatarURL := c.AvatarURL(&ModelUser{ID: "1", Avatar: "a_b"})
+	if avatarURL != expected {
+		t.Fatalf("expected %v but got %v", expected, avatarURL)
+	}
+	expected = srv.URL + "/api/v9/webhooks/1/token"
+	webhookURL := c.WebhookURL("1", "token")
+	if webhookURL != expected {
+		t.Fatalf("expected %v but got %v", expected, webhookURL)
+	}
+}
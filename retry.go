@@ -0,0 +1,151 @@
+package discgo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides which failed requests RESTClient retries and how long it waits in between.
+type RetryPolicy struct {
+	// Maximum number of times a request is sent, including the first.
+	MaxAttempts int
+
+	// The wait before the nth retry is a random duration up to BaseDelay * 2^(n-1), capped at MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration // 0 means uncapped.
+
+	// Response status codes that are retried. Requests that were rate limited
+	// are retried without any backoff because the RateLimiter already waits.
+	StatusCodes []int
+
+	// Reports whether a request that failed without a response should be retried.
+	// If nil, no such requests are retried.
+	RetryError func(err error) bool
+	// Such requests may have been handled by Discord so by default only those with an
+	// idempotent method are retried. Set to also retry e.g. POSTs, which may be duplicated.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy retries bad gateways, rate limited requests and idempotent requests
+// whose connection was reset, refused or timed out.
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	StatusCodes: []int{
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+		http.StatusTooManyRequests,
+	},
+	RetryError: IsNetworkError,
+}
+
+// IsNetworkError reports whether err is a transient connection level error,
+// i.e. a timeout, a reset or refused connection or an unexpected EOF.
+// Errors that would happen again, like an untrusted certificate, are not.
+// Such requests may or may not have been handled by Discord.
+func IsNetworkError(err error) bool {
+	// *url.Error is a net.Error for any error from http.Client.
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func (rp *RetryPolicy) shouldRetry(req *http.Request, err error) (retry, backoff bool) {
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		if _, ok := err.(*RateLimitError); ok {
+			return false, false
+		}
+		if !rp.RetryNonIdempotent && !isIdempotent(req.Method) {
+			return false, false
+		}
+		return rp.RetryError != nil && rp.RetryError(err), true
+	}
+
+	for _, code := range rp.StatusCodes {
+		if apiErr.Response.StatusCode == code {
+			return true, code != http.StatusTooManyRequests
+		}
+	}
+	return false, false
+}
+
+// maxDelay returns the longest wait after the given attempt.
+func (rp *RetryPolicy) maxDelay(attempt int) time.Duration {
+	max := rp.MaxDelay
+	if max <= 0 {
+		max = math.MaxInt64
+	}
+	d := rp.BaseDelay
+	for i := 1; i < attempt; i++ {
+		if d > max/2 {
+			return max
+		}
+		d *= 2
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+func (rp *RetryPolicy) backoff(ctx context.Context, attempt int) error {
+	d := rp.maxDelay(attempt)
+	if d <= 0 {
+		return nil
+	}
+	d = time.Duration(rand.Int63n(int64(d)))
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var errBodyNotRewindable = errors.New("cannot retry request; its body cannot be rewound")
+
+// rewindRequest returns a copy of req with a fresh body so that it can be sent again.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, errBodyNotRewindable
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	req2 := req.WithContext(req.Context())
+	req2.Body = body
+	return req2, nil
+}
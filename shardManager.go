@@ -0,0 +1,264 @@
+package discgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nhooyr/log"
+)
+
+// ShardEventHandler is like EventHandler but is also given the shard that received the event.
+type ShardEventHandler interface {
+	HandleShard(ctx context.Context, shard int, e interface{}) error
+}
+
+type ShardEventHandlerFunc func(ctx context.Context, shard int, e interface{}) error
+
+func (h ShardEventHandlerFunc) HandleShard(ctx context.Context, shard int, e interface{}) error {
+	return h(ctx, shard, e)
+}
+
+// ShardManager runs a GatewayClient for every shard.
+// If Discord closes a shard with CloseCodeShardingRequired, it reconnects every shard
+// with more shards.
+type ShardManager struct {
+	Token string
+	// Used to get the gateway URL and the recommended number of shards.
+	// Defaults to a RESTClient with Token.
+	RESTClient *RESTClient
+	APIVersion string // defaults to DefaultAPIVersion.
+	// Defaults to the number of shards recommended by Discord.
+	ShardCount   int
+	EventHandler ShardEventHandler
+	ErrorHandler func(shard int, err error)
+	Logf         func(format string, v ...interface{})
+	Debug        bool // enables logging of events.
+	// Shared by every shard. Defaults to a new IdentifyLimiter.
+	IdentifyLimiter *IdentifyLimiter
+	ZlibStream      bool   // see GatewayClient.ZlibStream.
+	Encoding        string // see GatewayClient.Encoding.
+
+	mu         sync.Mutex
+	shards     []*shard
+	generation int
+	closed     bool
+}
+
+type shard struct {
+	c          *GatewayClient
+	generation int
+
+	mu     sync.Mutex
+	status ShardStatus
+}
+
+// ShardStatus describes a shard of a ShardManager.
+type ShardStatus struct {
+	Shard      int
+	ShardCount int
+	// Whether the shard's connection has received Ready or Resumed.
+	Ready     bool
+	Events    int
+	LastEvent time.Time
+	// Round trip time of the last acknowledged heartbeat.
+	Latency time.Duration
+	// Set once the shard has terminated permanently.
+	Terminated bool
+	Err        error
+}
+
+var errShardManagerClosed = errors.New("shard manager closed")
+
+// Connect connects every shard. Identifies are spaced out by the IdentifyLimiter
+// so the shards become ready one after another.
+func (m *ShardManager) Connect(ctx context.Context) error {
+	if m.Token == "" {
+		panic("missing API token")
+	}
+	if m.RESTClient == nil {
+		m.RESTClient = &RESTClient{Token: m.Token}
+	}
+	if m.Logf == nil {
+		m.Logf = func(f string, v ...interface{}) {
+			log.Printf(f, v...)
+		}
+	}
+	if m.ErrorHandler == nil {
+		m.ErrorHandler = func(shard int, err error) {
+			m.Logf("shard %v: %v", shard, err)
+		}
+	}
+	if m.IdentifyLimiter == nil {
+		m.IdentifyLimiter = new(IdentifyLimiter)
+	}
+
+	return m.connect(ctx, 1, 0)
+}
+
+// connect replaces the shards with new ones.
+// If generation is not 0, it does nothing unless the shards are still of that generation.
+// m.mu is not held while shards are closed as their handlers may call Status.
+func (m *ShardManager) connect(ctx context.Context, minShardCount, generation int) error {
+	resp, err := m.RESTClient.Gateway().Bot().Get(ctx)
+	if err != nil {
+		return err
+	}
+	shardCount := m.ShardCount
+	if shardCount == 0 {
+		shardCount = resp.Shards
+	}
+	if shardCount < minShardCount {
+		shardCount = minShardCount
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return errShardManagerClosed
+	}
+	if generation != 0 && generation != m.generation {
+		// Already resharded.
+		m.mu.Unlock()
+		return nil
+	}
+	m.generation++
+	generation = m.generation
+	old := m.shards
+	m.shards = nil
+	m.mu.Unlock()
+	closeShards(old)
+
+	shards := make([]*shard, 0, shardCount)
+	for i := 0; i < shardCount; i++ {
+		sh := m.newShard(resp.URL, i, shardCount, generation)
+		err = sh.c.Connect()
+		if err != nil {
+			closeShards(shards)
+			return err
+		}
+		shards = append(shards, sh)
+	}
+
+	m.mu.Lock()
+	if m.closed || generation != m.generation {
+		m.mu.Unlock()
+		closeShards(shards)
+		if m.closed {
+			return errShardManagerClosed
+		}
+		return nil
+	}
+	m.shards = shards
+	m.mu.Unlock()
+	for _, sh := range shards {
+		go m.supervise(sh)
+	}
+	return nil
+}
+
+func (m *ShardManager) newShard(gatewayURL string, id, shardCount, generation int) *shard {
+	sh := &shard{
+		generation: generation,
+		status: ShardStatus{
+			Shard:      id,
+			ShardCount: shardCount,
+		},
+	}
+	sh.c = &GatewayClient{
+		Token:      m.Token,
+		GatewayURL: gatewayURL,
+		APIVersion: m.APIVersion,
+		EventHandler: EventHandlerFunc(func(ctx context.Context, e interface{}) error {
+			sh.observe(e)
+			if m.EventHandler == nil {
+				return nil
+			}
+			return m.EventHandler.HandleShard(ctx, id, e)
+		}),
+		ErrorHandler: func(err error) {
+			m.ErrorHandler(id, err)
+		},
+		Logf: func(f string, v ...interface{}) {
+			m.Logf("shard %v: %v", id, fmt.Sprintf(f, v...))
+		},
+		Debug:           m.Debug,
+		Shard:           id,
+		ShardCount:      shardCount,
+		IdentifyLimiter: m.IdentifyLimiter,
+		ZlibStream:      m.ZlibStream,
+		Encoding:        m.Encoding,
+	}
+	return sh
+}
+
+func (sh *shard) observe(e interface{}) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.status.Events++
+	sh.status.LastEvent = time.Now()
+}
+
+// supervise waits for the shard to terminate and reshards if Discord requires it.
+func (m *ShardManager) supervise(sh *shard) {
+	<-sh.c.Done()
+	err := sh.c.Err()
+
+	sh.mu.Lock()
+	sh.status.Terminated = true
+	sh.status.Err = err
+	shardCount := sh.status.ShardCount
+	sh.mu.Unlock()
+
+	closeErr, ok := err.(*GatewayCloseError)
+	if !ok || closeErr.Code != CloseCodeShardingRequired {
+		return
+	}
+
+	m.Logf("resharding")
+	err = m.connect(context.Background(), shardCount+1, sh.generation)
+	if err != nil && err != errShardManagerClosed {
+		m.ErrorHandler(sh.status.Shard, err)
+	}
+}
+
+// Reshard closes every shard and reconnects them with the configured or
+// recommended number of shards.
+func (m *ShardManager) Reshard(ctx context.Context) error {
+	return m.connect(ctx, 1, 0)
+}
+
+func closeShards(shards []*shard) {
+	for _, sh := range shards {
+		sh.c.Close()
+	}
+}
+
+// Status returns the status of every shard.
+func (m *ShardManager) Status() []ShardStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]ShardStatus, len(m.shards))
+	for i, sh := range m.shards {
+		sh.mu.Lock()
+		statuses[i] = sh.status
+		sh.mu.Unlock()
+		cs := sh.c.Status()
+		statuses[i].Ready = cs.Ready
+		statuses[i].Latency = cs.Latency
+	}
+	return statuses
+}
+
+// Close closes every shard. It never returns an error.
+func (m *ShardManager) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	shards := m.shards
+	m.shards = nil
+	m.mu.Unlock()
+	closeShards(shards)
+	return nil
+}
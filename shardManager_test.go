@@ -0,0 +1,149 @@
+package discgo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nhooyr/discgo/discgotest"
+)
+
+type shardEvent struct {
+	shard int
+	e     interface{}
+}
+
+func newTestShardManager(t *testing.T, recommendedShards, requiredShards int, opts ...func(m *ShardManager)) (*ShardManager, *discgotest.Gateway, chan shardEvent) {
+	srv := discgotest.NewServer("token")
+	t.Cleanup(srv.Close)
+	gw := discgotest.NewGateway(srv.Token)
+	gw.ShardCount = requiredShards
+	t.Cleanup(gw.Close)
+	srv.GatewayURL = gw.URL
+	srv.Shards = recommendedShards
+
+	events := make(chan shardEvent, 100)
+	m := &ShardManager{
+		Token:           srv.Token,
+		RESTClient:      &RESTClient{Token: srv.Token, BaseURL: srv.URL},
+		IdentifyLimiter: &IdentifyLimiter{Interval: time.Millisecond},
+		Logf:            t.Logf,
+		EventHandler: ShardEventHandlerFunc(func(ctx context.Context, shard int, e interface{}) error {
+			events <- shardEvent{shard, e}
+			return nil
+		}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	err := m.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, gw, events
+}
+
+func waitShardsReady(t *testing.T, m *ShardManager, shardCount int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		statuses := m.Status()
+		ready := 0
+		for _, s := range statuses {
+			if s.Ready && !s.Terminated {
+				ready++
+			}
+		}
+		if len(statuses) == shardCount && ready == shardCount {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %v ready shards but got %+v", shardCount, m.Status())
+}
+
+func TestShardManager_Connect(t *testing.T) {
+	m, gw, events := newTestShardManager(t, 2, 2)
+	defer m.Close()
+	waitShardsReady(t, m, 2)
+
+	err := gw.DispatchShard(1, "MESSAGE_CREATE", map[string]string{"id": "1", "content": "boar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case se := <-events:
+			if _, ok := se.e.(*EventMessageCreate); !ok {
+				continue
+			}
+			if se.shard != 1 {
+				t.Fatalf("expected shard %v but got %v", 1, se.shard)
+			}
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func TestShardManager_ShardingRequired(t *testing.T) {
+	m, gw, _ := newTestShardManager(t, 1, 2)
+	defer m.Close()
+	waitShardsReady(t, m, 2)
+
+	if gw.Sessions() != 2 {
+		t.Fatalf("expected %v but got %v sessions", 2, gw.Sessions())
+	}
+	for i, s := range m.Status() {
+		if s.ShardCount != 2 {
+			t.Fatalf("expected shard %v to have a count of %v but got %v", i, 2, s.ShardCount)
+		}
+	}
+}
+
+func TestShardManager_CloseFromHandler(t *testing.T) {
+	handling := make(chan struct{})
+	m, gw, _ := newTestShardManager(t, 1, 1, func(m *ShardManager) {
+		m.EventHandler = ShardEventHandlerFunc(func(ctx context.Context, shard int, e interface{}) error {
+			if _, ok := e.(*EventMessageCreate); ok {
+				close(handling)
+				// Give Close time to start waiting for the handler.
+				time.Sleep(50 * time.Millisecond)
+				m.Status()
+			}
+			return nil
+		})
+	})
+	waitShardsReady(t, m, 1)
+
+	err := gw.DispatchShard(0, "MESSAGE_CREATE", map[string]string{"id": "1", "content": "boar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-handling
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Close to return")
+	}
+}
+
+func TestShardManager_ReadyAfterDisconnect(t *testing.T) {
+	m, gw, _ := newTestShardManager(t, 1, 1)
+	defer m.Close()
+	waitShardsReady(t, m, 1)
+
+	gw.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Status()[0].Ready {
+		if time.Now().After(deadline) {
+			t.Fatal("expected shard to not be ready after disconnecting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
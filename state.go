@@ -210,6 +210,13 @@ func (sg *StateGuild) VoiceStates() []*ModelVoiceState {
 	return voiceStates
 }
 
+func (sg *StateGuild) VoiceState(uID string) (*ModelVoiceState, bool) {
+	sg.voiceStatesMu.RLock()
+	vs, ok := sg.voiceStates[uID]
+	sg.voiceStatesMu.RUnlock()
+	return vs, ok
+}
+
 // Only cause discord API sends it.
 func (sg *StateGuild) MemberCount() int {
 	sg.membersMu.RLock()
@@ -555,7 +562,7 @@ func (s *State) insertChannel(c *ModelChannel) error {
 		return errUnknownGuild
 	}
 
-	sc = new(StateChannel)
+	sc = &StateChannel{guild: sg}
 	sc.updateFromModel(c)
 
 	s.guildChannelsMu.Lock()
@@ -625,7 +632,7 @@ func (s *State) createGuild(e *EventGuildCreate) error {
 	s.guildsMu.Lock()
 	s.guildChannelsMu.Lock()
 	for _, c := range e.Channels {
-		sc := new(StateChannel)
+		sc := &StateChannel{guild: sg}
 		sc.updateFromModel(c)
 
 		sg.channels[c.ID] = sc
@@ -741,9 +748,18 @@ func (s *State) updateGuildMember(e *EventGuildMemberUpdate) error {
 	return nil
 }
 
-// TODO not sure how to handle this stuff
+// chunkGuildMembers stores the members sent in response to GatewayClient.RequestGuildMembers.
 func (s *State) chunkGuildMembers(e *EventGuildMembersChunk) error {
-	panic("TODO")
+	sg, ok := s.guilds[e.GuildID]
+	if !ok {
+		return errUnknownGuild
+	}
+	sg.membersMu.Lock()
+	for _, gm := range e.Members {
+		sg.members[gm.User.ID] = gm
+	}
+	sg.membersMu.Unlock()
+	return nil
 }
 
 func (s *State) createGuildRole(e *EventGuildRoleCreate) error {
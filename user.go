@@ -2,8 +2,10 @@ package discgo
 
 import (
 	"context"
+	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
 type ModelUser struct {
@@ -160,3 +162,17 @@ func (e EndpointMe) Connections() EndpointMeConnections {
 func (e EndpointMeConnections) Get(ctx context.Context) (connections []*ModelConnection, err error) {
 	return connections, e.doMethod(ctx, "GET", nil, &connections)
 }
+
+// AvatarURL returns the CDN URL of the avatar of u.
+// If u has no avatar, the URL of its default avatar is returned.
+func (c *RESTClient) AvatarURL(u *ModelUser) string {
+	if u.Avatar == "" {
+		discriminator, _ := strconv.Atoi(u.Discriminator)
+		return fmt.Sprintf("%v/embed/avatars/%v.png", c.cdnURL(), discriminator%5)
+	}
+	ext := "png"
+	if strings.HasPrefix(u.Avatar, "a_") {
+		ext = "gif"
+	}
+	return fmt.Sprintf("%v/avatars/%v/%v.%v", c.cdnURL(), u.ID, u.Avatar, ext)
+}
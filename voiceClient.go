@@ -0,0 +1,645 @@
+package discgo
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nhooyr/log"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// DefaultVoiceAPIVersion is the version of the voice gateway used by VoiceClient.
+const DefaultVoiceAPIVersion = "3"
+
+const voiceMode = "xsalsa20_poly1305"
+
+const (
+	voiceOperationIdentify = iota
+	voiceOperationSelectProtocol
+	voiceOperationReady
+	voiceOperationHeartbeat
+	voiceOperationSessionDescription
+	voiceOperationSpeaking
+	voiceOperationHeartbeatACK
+	voiceOperationResume
+	voiceOperationHello
+	voiceOperationClientDisconnect = 13
+)
+
+// OpusReader is a source of Opus packets.
+type OpusReader interface {
+	// ReadOpus returns the next 20ms Opus packet or io.EOF once there are none.
+	ReadOpus() ([]byte, error)
+}
+
+type OpusReaderFunc func() ([]byte, error)
+
+func (fn OpusReaderFunc) ReadOpus() ([]byte, error) {
+	return fn()
+}
+
+type opusFrameReader struct {
+	r io.Reader
+}
+
+// NewOpusReader returns an OpusReader reading packets prefixed with their length
+// as a little endian int16, like DCA files without metadata.
+func NewOpusReader(r io.Reader) OpusReader {
+	return opusFrameReader{r}
+}
+
+func (r opusFrameReader) ReadOpus() ([]byte, error) {
+	var n int16
+	err := binary.Read(r.r, binary.LittleEndian, &n)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, errors.New("negative opus packet length")
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r.r, b)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+// Every Opus packet is 20ms of 48kHz audio.
+const (
+	opusFrameDuration = 20 * time.Millisecond
+	opusFrameSamples  = 960
+)
+
+// Sent after the audio to avoid interpolation, see
+// https://discordapp.com/developers/docs/topics/voice-connections#voice-data-interpolation
+var opusSilence = []byte{0xF8, 0xFF, 0xFE}
+
+const opusSilenceFrames = 5
+
+// VoiceClient sends and receives audio in the voice channel of a VoiceSession.
+// It does not reconnect; once Done is closed a new VoiceClient is needed.
+type VoiceClient struct {
+	// From GatewayClient.JoinVoice.
+	Session      *VoiceSession
+	ErrorHandler func(err error)
+	Logf         func(format string, v ...interface{})
+	Debug        bool // enables logging of payloads.
+	// Called in a new goroutine with the stream of every user that sends us audio.
+	// If nil, received audio is discarded.
+	StreamHandler func(s *VoiceStream)
+
+	wsConn    *websocket.Conn
+	writeChan chan *sentPayload
+	udpConn   *net.UDPConn
+	ssrc      uint32
+	secretKey [32]byte
+
+	closeChan chan struct{}
+	errChan   chan error
+	done      chan struct{}
+	err       error
+	wg        sync.WaitGroup
+
+	heartbeatMu           sync.Mutex
+	heartbeatAcknowledged bool
+
+	// Held by SendOpus.
+	sendMu    sync.Mutex
+	sequence  uint16
+	timestamp uint32
+
+	streamsMu sync.Mutex
+	ssrcUsers map[uint32]string
+	streams   map[uint32]*VoiceStream
+}
+
+func (c *VoiceClient) log(v interface{}) {
+	c.Logf("%v", v)
+}
+
+type dataVoiceOpHello struct {
+	HeartbeatInterval float64 `json:"heartbeat_interval"`
+}
+
+type dataVoiceOpIdentify struct {
+	ServerID  string `json:"server_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	Token     string `json:"token"`
+}
+
+type dataVoiceOpReady struct {
+	SSRC  uint32   `json:"ssrc"`
+	IP    string   `json:"ip"`
+	Port  int      `json:"port"`
+	Modes []string `json:"modes"`
+}
+
+type dataVoiceOpSelectProtocol struct {
+	Protocol string                        `json:"protocol"`
+	Data     dataVoiceOpSelectProtocolData `json:"data"`
+}
+
+type dataVoiceOpSelectProtocolData struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+	Mode    string `json:"mode"`
+}
+
+type dataVoiceOpSessionDescription struct {
+	Mode      string   `json:"mode"`
+	SecretKey [32]byte `json:"secret_key"`
+}
+
+type dataVoiceOpSpeaking struct {
+	Speaking bool   `json:"speaking"`
+	Delay    int    `json:"delay"`
+	SSRC     uint32 `json:"ssrc"`
+	// Only received.
+	UserID string `json:"user_id,omitempty"`
+}
+
+type dataVoiceOpClientDisconnect struct {
+	UserID string `json:"user_id"`
+}
+
+// Connect connects to the voice server, discovers our external address and
+// negotiates encryption. Audio can be sent once it returns.
+func (c *VoiceClient) Connect(ctx context.Context) error {
+	if c.Session == nil {
+		panic("missing voice session")
+	}
+	if c.Logf == nil {
+		c.Logf = func(f string, v ...interface{}) {
+			log.Printf(f, v...)
+		}
+	}
+	if c.ErrorHandler == nil {
+		c.ErrorHandler = func(err error) {
+			c.log(err)
+		}
+	}
+
+	c.closeChan = make(chan struct{})
+	c.errChan = make(chan error)
+	c.done = make(chan struct{})
+	c.writeChan = make(chan *sentPayload)
+	c.heartbeatAcknowledged = true
+	c.ssrcUsers = make(map[uint32]string)
+	c.streams = make(map[uint32]*VoiceStream)
+
+	heartbeatInterval, err := c.connect(ctx)
+	if err != nil {
+		if c.wsConn != nil {
+			c.wsConn.Close()
+		}
+		if c.udpConn != nil {
+			c.udpConn.Close()
+		}
+		close(c.done)
+		return err
+	}
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	c.runWorker(func() {
+		c.writeLoop(ctx)
+	})
+	c.runWorker(func() {
+		c.readLoop(ctx)
+	})
+	c.runWorker(func() {
+		c.heartbeatLoop(ctx, heartbeatInterval)
+	})
+	c.runWorker(func() {
+		c.udpReadLoop(ctx)
+	})
+	go c.manager(cancelFn)
+	return nil
+}
+
+// connect performs the handshake and returns the heartbeat interval.
+func (c *VoiceClient) connect(ctx context.Context) (time.Duration, error) {
+	c.Logf("connecting to voice")
+	dialURL, err := c.dialURL()
+	if err != nil {
+		return 0, err
+	}
+	c.wsConn, _, err = websocket.DefaultDialer.Dial(dialURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.wsConn.SetReadDeadline(deadline)
+		c.wsConn.SetWriteDeadline(deadline)
+	}
+
+	var hello dataVoiceOpHello
+	err = c.readUntil(voiceOperationHello, &hello)
+	if err != nil {
+		return 0, err
+	}
+
+	err = c.wsConn.WriteJSON(&sentPayload{
+		Operation: voiceOperationIdentify,
+		Data: &dataVoiceOpIdentify{
+			ServerID:  c.Session.GuildID,
+			UserID:    c.Session.UserID,
+			SessionID: c.Session.SessionID,
+			Token:     c.Session.Token,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var ready dataVoiceOpReady
+	err = c.readUntil(voiceOperationReady, &ready)
+	if err != nil {
+		return 0, err
+	}
+	c.ssrc = ready.SSRC
+
+	raddr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(ready.IP, strconv.Itoa(ready.Port)))
+	if err != nil {
+		return 0, err
+	}
+	c.udpConn, err = net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return 0, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.udpConn.SetDeadline(deadline)
+	}
+	ip, port, err := c.discoverIP()
+	if err != nil {
+		return 0, err
+	}
+
+	err = c.wsConn.WriteJSON(&sentPayload{
+		Operation: voiceOperationSelectProtocol,
+		Data: &dataVoiceOpSelectProtocol{
+			Protocol: "udp",
+			Data: dataVoiceOpSelectProtocolData{
+				Address: ip,
+				Port:    port,
+				Mode:    voiceMode,
+			},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var sd dataVoiceOpSessionDescription
+	err = c.readUntil(voiceOperationSessionDescription, &sd)
+	if err != nil {
+		return 0, err
+	}
+	if sd.Mode != voiceMode {
+		return 0, fmt.Errorf("unexpected voice encryption mode %q", sd.Mode)
+	}
+	c.secretKey = sd.SecretKey
+
+	var zero time.Time
+	c.wsConn.SetReadDeadline(zero)
+	c.wsConn.SetWriteDeadline(zero)
+	c.udpConn.SetDeadline(zero)
+	c.Logf("connected to voice")
+	return time.Duration(hello.HeartbeatInterval * float64(time.Millisecond)), nil
+}
+
+func (c *VoiceClient) dialURL() (string, error) {
+	endpoint := c.Session.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		// Discord appends a port we should not use.
+		endpoint = "wss://" + strings.TrimSuffix(endpoint, ":80")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("v", DefaultVoiceAPIVersion)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// readUntil reads payloads during the handshake until one with the given operation.
+func (c *VoiceClient) readUntil(op int, v interface{}) error {
+	for {
+		p, err := c.readPayload()
+		if err != nil {
+			return err
+		}
+		if p.Operation == op {
+			return json.Unmarshal(p.Data, v)
+		}
+	}
+}
+
+func (c *VoiceClient) readPayload() (*receivedPayload, error) {
+	var p receivedPayload
+	err := c.wsConn.ReadJSON(&p)
+	if err != nil {
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			return nil, &VoiceCloseError{
+				Code: VoiceCloseCode(closeErr.Code),
+				Text: closeErr.Text,
+			}
+		}
+		return nil, err
+	}
+	if c.Debug {
+		b, err := json.MarshalIndent(p, "", "    ")
+		if err != nil {
+			panic(err)
+		}
+		c.Logf("voice read: %s", b)
+	}
+	return &p, nil
+}
+
+// discoverIP asks the voice server for our external address.
+// See https://discordapp.com/developers/docs/topics/voice-connections#ip-discovery
+func (c *VoiceClient) discoverIP() (ip string, port int, err error) {
+	b := make([]byte, 70)
+	binary.BigEndian.PutUint32(b, c.ssrc)
+	_, err = c.udpConn.Write(b)
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := c.udpConn.Read(b)
+	if err != nil {
+		return "", 0, err
+	}
+	if n != 70 {
+		return "", 0, errors.New("unexpected ip discovery response")
+	}
+	ipb := b[4:68]
+	if i := strings.IndexByte(string(ipb), 0); i >= 0 {
+		ipb = ipb[:i]
+	}
+	return string(ipb), int(binary.LittleEndian.Uint16(b[68:])), nil
+}
+
+func (c *VoiceClient) runWorker(fn func()) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		fn()
+	}()
+}
+
+func (c *VoiceClient) manager(cancelFn context.CancelFunc) {
+	select {
+	case err := <-c.errChan:
+		c.ErrorHandler(err)
+		c.err = err
+	case <-c.closeChan:
+	}
+	c.Logf("disconnecting from voice")
+
+	cancelFn()
+	// Unblocks readLoop and udpReadLoop.
+	c.wsConn.Close()
+	c.udpConn.Close()
+	c.wg.Wait()
+	c.closeStreams()
+	close(c.done)
+}
+
+// fail terminates the client because of err unless it is already terminating.
+func (c *VoiceClient) fail(ctx context.Context, err error) {
+	select {
+	case c.errChan <- err:
+	case <-ctx.Done():
+	}
+}
+
+// Done returns a channel that is closed once the client has disconnected,
+// either because of Close or because of an error.
+func (c *VoiceClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that disconnected the client, if any.
+func (c *VoiceClient) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+var errVoiceClientDone = errors.New("voice client is done")
+
+func (c *VoiceClient) write(ctx context.Context, p *sentPayload) error {
+	select {
+	case c.writeChan <- p:
+		return nil
+	case <-c.done:
+		return errVoiceClientDone
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *VoiceClient) writeLoop(ctx context.Context) {
+	for {
+		select {
+		case p := <-c.writeChan:
+			err := c.wsConn.WriteJSON(p)
+			if err != nil {
+				c.fail(ctx, err)
+				return
+			}
+			if c.Debug {
+				b, err := json.MarshalIndent(p, "", "    ")
+				if err != nil {
+					panic(err)
+				}
+				c.Logf("voice write: %s", b)
+			}
+		case <-ctx.Done():
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			c.wsConn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+			return
+		}
+	}
+}
+
+func (c *VoiceClient) readLoop(ctx context.Context) {
+	for {
+		p, err := c.readPayload()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				// Closing.
+			default:
+				c.fail(ctx, err)
+			}
+			return
+		}
+
+		err = c.onPayload(p)
+		if err != nil {
+			c.fail(ctx, err)
+			return
+		}
+	}
+}
+
+func (c *VoiceClient) onPayload(p *receivedPayload) error {
+	switch p.Operation {
+	case voiceOperationHeartbeatACK:
+		c.heartbeatMu.Lock()
+		c.heartbeatAcknowledged = true
+		c.heartbeatMu.Unlock()
+	case voiceOperationSpeaking:
+		var speaking dataVoiceOpSpeaking
+		err := json.Unmarshal(p.Data, &speaking)
+		if err != nil {
+			return err
+		}
+		c.onSpeaking(&speaking)
+	case voiceOperationClientDisconnect:
+		var cd dataVoiceOpClientDisconnect
+		err := json.Unmarshal(p.Data, &cd)
+		if err != nil {
+			return err
+		}
+		c.onClientDisconnect(cd.UserID)
+	}
+	return nil
+}
+
+func (c *VoiceClient) heartbeatLoop(ctx context.Context, heartbeatInterval time.Duration) {
+	t := time.NewTicker(heartbeatInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			c.heartbeatMu.Lock()
+			if !c.heartbeatAcknowledged {
+				c.heartbeatMu.Unlock()
+				c.fail(ctx, errors.New("voice heartbeat not acknowledged"))
+				return
+			}
+			c.heartbeatAcknowledged = false
+			c.heartbeatMu.Unlock()
+
+			// The nonce is echoed in the acknowledgment.
+			nonce := time.Now().UnixNano() / int64(time.Millisecond)
+			err := c.write(ctx, &sentPayload{Operation: voiceOperationHeartbeat, Data: nonce})
+			if err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Speaking sets our speaking state. It must be true while sending audio.
+// SendOpus sets it automatically.
+func (c *VoiceClient) Speaking(ctx context.Context, speaking bool) error {
+	return c.write(ctx, &sentPayload{
+		Operation: voiceOperationSpeaking,
+		Data: &dataVoiceOpSpeaking{
+			Speaking: speaking,
+			SSRC:     c.ssrc,
+		},
+	})
+}
+
+// SendOpus sends the packets of src every 20ms until it returns io.EOF.
+// Only one SendOpus runs at a time; concurrent calls wait.
+func (c *VoiceClient) SendOpus(ctx context.Context, src OpusReader) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	err := c.Speaking(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	t := time.NewTicker(opusFrameDuration)
+	defer t.Stop()
+	send := func(opus []byte) error {
+		select {
+		case <-t.C:
+		case <-c.done:
+			return errVoiceClientDone
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return c.sendPacket(opus)
+	}
+
+	for {
+		opus, err := src.ReadOpus()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		err = send(opus)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < opusSilenceFrames; i++ {
+		err = send(opusSilence)
+		if err != nil {
+			return err
+		}
+	}
+	return c.Speaking(ctx, false)
+}
+
+// sendPacket encrypts opus into an RTP packet.
+// See https://discordapp.com/developers/docs/topics/voice-connections#encrypting-and-sending-voice
+func (c *VoiceClient) sendPacket(opus []byte) error {
+	packet := make([]byte, 12, 12+len(opus)+secretbox.Overhead)
+	packet[0] = 0x80
+	packet[1] = 0x78
+	binary.BigEndian.PutUint16(packet[2:], c.sequence)
+	binary.BigEndian.PutUint32(packet[4:], c.timestamp)
+	binary.BigEndian.PutUint32(packet[8:], c.ssrc)
+	c.sequence++
+	c.timestamp += opusFrameSamples
+
+	var nonce [24]byte
+	copy(nonce[:], packet)
+	packet = secretbox.Seal(packet, opus, &nonce, &c.secretKey)
+	_, err := c.udpConn.Write(packet)
+	return err
+}
+
+// Close disconnects from the voice server. It never returns an error.
+// It does not leave the voice channel, use GatewayClient.UpdateVoiceState for that.
+// It does nothing if Connect was never called.
+func (c *VoiceClient) Close() error {
+	if c.done == nil {
+		return nil
+	}
+	select {
+	case c.closeChan <- struct{}{}:
+		<-c.done
+	case <-c.done:
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package discgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nhooyr/discgo/discgotest"
+)
+
+type testVoice struct {
+	*discgotest.VoiceServer
+	c *VoiceClient
+}
+
+// newTestVoice joins a voice channel through a fake gateway and connects a
+// VoiceClient to a fake voice server.
+func newTestVoice(t *testing.T, configure ...func(c *VoiceClient)) *testVoice {
+	vs := discgotest.NewVoiceServer()
+	vs.HeartbeatInterval = 50 * time.Millisecond
+	t.Cleanup(vs.Close)
+	tg := newTestGateway(t, func(tg *testGateway) {
+		tg.VoiceEndpoint = vs.URL
+	})
+	t.Cleanup(tg.close)
+	tg.nextPayload(t, discgotest.OpIdentify)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	session, err := tg.c.JoinVoice(ctx, gID, cID, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tv := &testVoice{
+		VoiceServer: vs,
+		c: &VoiceClient{
+			Session: session,
+			Logf:    t.Logf,
+		},
+	}
+	for _, fn := range configure {
+		fn(tv.c)
+	}
+	err = tv.c.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		tv.c.Close()
+	})
+	return tv
+}
+
+func (tv *testVoice) nextPayload(t *testing.T, op int) *discgotest.GatewayPayload {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := tv.Next(ctx, op)
+	if err != nil {
+		t.Fatalf("waiting for voice op %v: %v", op, err)
+	}
+	return p
+}
+
+func (tv *testVoice) expectSpeaking(t *testing.T, speaking bool) {
+	p := tv.nextPayload(t, discgotest.VoiceOpSpeaking)
+	var d dataVoiceOpSpeaking
+	err := json.Unmarshal(p.D, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Speaking != speaking {
+		t.Fatalf("expected speaking %v but got %v", speaking, d.Speaking)
+	}
+	if d.SSRC != tv.SSRC {
+		t.Fatalf("expected ssrc %v but got %v", tv.SSRC, d.SSRC)
+	}
+}
+
+func TestVoiceClient_Connect(t *testing.T) {
+	tv := newTestVoice(t)
+
+	p := tv.nextPayload(t, discgotest.VoiceOpIdentify)
+	var identify dataVoiceOpIdentify
+	err := json.Unmarshal(p.D, &identify)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := dataVoiceOpIdentify{
+		ServerID:  gID,
+		UserID:    "1",
+		SessionID: "1",
+		Token:     discgotest.VoiceToken,
+	}
+	if identify != expected {
+		t.Fatalf("expected %+v but got %+v", expected, identify)
+	}
+
+	p = tv.nextPayload(t, discgotest.VoiceOpSelectProtocol)
+	var sp dataVoiceOpSelectProtocol
+	err = json.Unmarshal(p.D, &sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sp.Data.Address != "127.0.0.1" || sp.Data.Port == 0 {
+		t.Fatalf("expected the discovered address but got %v:%v", sp.Data.Address, sp.Data.Port)
+	}
+
+	// Heartbeats keep the connection alive.
+	tv.nextPayload(t, discgotest.VoiceOpHeartbeat)
+	tv.nextPayload(t, discgotest.VoiceOpHeartbeat)
+	select {
+	case <-tv.c.Done():
+		t.Fatalf("expected client to be connected but got %v", tv.c.Err())
+	default:
+	}
+}
+
+func TestVoiceClient_SendOpus(t *testing.T) {
+	tv := newTestVoice(t)
+
+	frames := [][]byte{{1}, {2, 2}, {3, 3, 3}}
+	var b bytes.Buffer
+	for _, f := range frames {
+		binary.Write(&b, binary.LittleEndian, int16(len(f)))
+		b.Write(f)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	err := tv.c.SendOpus(ctx, NewOpusReader(&b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tv.expectSpeaking(t, true)
+	for i := 0; i < len(frames)+opusSilenceFrames; i++ {
+		p, err := tv.NextPacket(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opus := opusSilence
+		if i < len(frames) {
+			opus = frames[i]
+		}
+		if !bytes.Equal(p.Opus, opus) {
+			t.Fatalf("expected packet %v to be %v but got %v", i, opus, p.Opus)
+		}
+		if p.Sequence != uint16(i) {
+			t.Fatalf("expected sequence %v but got %v", i, p.Sequence)
+		}
+		if p.Timestamp != uint32(i*opusFrameSamples) {
+			t.Fatalf("expected timestamp %v but got %v", i*opusFrameSamples, p.Timestamp)
+		}
+		if p.SSRC != tv.SSRC {
+			t.Fatalf("expected ssrc %v but got %v", tv.SSRC, p.SSRC)
+		}
+	}
+	tv.expectSpeaking(t, false)
+}
+
+func TestVoiceClient_AuthenticationFailed(t *testing.T) {
+	vs := discgotest.NewVoiceServer()
+	defer vs.Close()
+
+	c := &VoiceClient{
+		Session: &VoiceSession{
+			GuildID:   gID,
+			UserID:    "1",
+			SessionID: "1",
+			Token:     "wrong",
+			Endpoint:  vs.URL,
+		},
+		Logf: t.Logf,
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	err := c.Connect(ctx)
+	closeErr, ok := err.(*VoiceCloseError)
+	if !ok || closeErr.Code != discgotest.VoiceCloseAuthenticationFailed {
+		t.Fatalf("expected close code %v but got %v", discgotest.VoiceCloseAuthenticationFailed, err)
+	}
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("expected client to be done")
+	}
+}
+
+func TestVoiceClient_CloseBeforeConnect(t *testing.T) {
+	err := new(VoiceClient).Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpusReader(t *testing.T) {
+	r := NewOpusReader(bytes.NewReader([]byte{2, 0, 1}))
+	_, err := r.ReadOpus()
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected %v but got %v", io.ErrUnexpectedEOF, err)
+	}
+	r = NewOpusReader(bytes.NewReader(nil))
+	_, err = r.ReadOpus()
+	if err != io.EOF {
+		t.Fatalf("expected %v but got %v", io.EOF, err)
+	}
+}
@@ -0,0 +1,268 @@
+package discgo
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// VoicePacket is an Opus packet received from a user.
+type VoicePacket struct {
+	Sequence  uint16
+	Timestamp uint32
+	Opus      []byte
+}
+
+// How many packets a VoiceStream holds back while waiting for a missing one.
+const jitterBufferSize = 5
+
+// Packets beyond this many that have not been read are dropped.
+const voiceStreamQueueSize = 64
+
+// VoiceStream is the audio of a user, in order.
+// Missing packets are waited for until jitterBufferSize newer ones have arrived,
+// packets that arrive after that are dropped.
+// Use StateGuild.VoiceState to know in which channel the user is.
+type VoiceStream struct {
+	UserID string
+	SSRC   uint32
+
+	packets chan *VoicePacket
+
+	mu      sync.Mutex
+	closed  bool
+	started bool
+	next    uint16
+	// Sorted by sequence, starting after next.
+	buffer []*VoicePacket
+}
+
+func newVoiceStream(userID string, ssrc uint32) *VoiceStream {
+	return &VoiceStream{
+		UserID:  userID,
+		SSRC:    ssrc,
+		packets: make(chan *VoicePacket, voiceStreamQueueSize),
+	}
+}
+
+// ReadPacket returns the next packet or io.EOF once the user has left or
+// the VoiceClient has disconnected.
+func (s *VoiceStream) ReadPacket(ctx context.Context) (*VoicePacket, error) {
+	select {
+	case p, ok := <-s.packets:
+		if !ok {
+			return nil, io.EOF
+		}
+		return p, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ReadOpus implements OpusReader so that a stream can be sent with SendOpus.
+func (s *VoiceStream) ReadOpus() ([]byte, error) {
+	p, err := s.ReadPacket(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return p.Opus, nil
+}
+
+// since returns how far after s.next seq is. Negative if it is before.
+func (s *VoiceStream) since(seq uint16) int16 {
+	return int16(seq - s.next)
+}
+
+func (s *VoiceStream) push(p *VoicePacket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if !s.started {
+		s.started = true
+		s.next = p.Sequence
+	}
+	d := s.since(p.Sequence)
+	if d < 0 {
+		// Late or duplicate.
+		return
+	}
+	i := sort.Search(len(s.buffer), func(i int) bool {
+		return s.since(s.buffer[i].Sequence) >= d
+	})
+	if i < len(s.buffer) && s.buffer[i].Sequence == p.Sequence {
+		return
+	}
+	s.buffer = append(s.buffer, nil)
+	copy(s.buffer[i+1:], s.buffer[i:])
+	s.buffer[i] = p
+	s.deliver(false)
+}
+
+// deliver is called with s.mu locked. It delivers the packets that are in order
+// and, if there are too many buffered or all is true, gives up on the missing ones.
+func (s *VoiceStream) deliver(all bool) {
+	for len(s.buffer) > 0 {
+		p := s.buffer[0]
+		if p.Sequence != s.next && !all && len(s.buffer) <= jitterBufferSize {
+			return
+		}
+		s.buffer = s.buffer[1:]
+		s.next = p.Sequence + 1
+		select {
+		case s.packets <- p:
+		default:
+			// The reader is too slow, dropping is better than blocking every other stream.
+		}
+	}
+}
+
+// flush delivers every buffered packet, e.g. because the user stopped speaking.
+func (s *VoiceStream) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.deliver(true)
+	}
+}
+
+func (s *VoiceStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.deliver(true)
+	s.closed = true
+	close(s.packets)
+}
+
+func (c *VoiceClient) udpReadLoop(ctx context.Context) {
+	b := make([]byte, 2048)
+	for {
+		n, err := c.udpConn.Read(b)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				// Closing.
+			default:
+				c.fail(ctx, err)
+			}
+			return
+		}
+
+		ssrc, p, ok := c.openPacket(b[:n])
+		if !ok {
+			continue
+		}
+		s := c.stream(ssrc)
+		if s != nil {
+			s.push(p)
+		}
+	}
+}
+
+// openPacket decrypts an RTP packet.
+// Anything else, e.g. RTCP, is ignored.
+func (c *VoiceClient) openPacket(b []byte) (ssrc uint32, p *VoicePacket, ok bool) {
+	if len(b) < 12 || b[0]>>6 != 2 {
+		return 0, nil, false
+	}
+	if b[1] >= 200 && b[1] <= 204 {
+		// RTCP.
+		return 0, nil, false
+	}
+	headerLen := 12 + 4*int(b[0]&0x0F)
+	if len(b) < headerLen {
+		return 0, nil, false
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], b[:12])
+	opus, ok := secretbox.Open(nil, b[headerLen:], &nonce, &c.secretKey)
+	if !ok {
+		return 0, nil, false
+	}
+	if b[0]&0x10 != 0 {
+		// Discord encrypts the header extension with the audio.
+		if len(opus) < 4 {
+			return 0, nil, false
+		}
+		extLen := 4 + 4*int(binary.BigEndian.Uint16(opus[2:]))
+		if len(opus) < extLen {
+			return 0, nil, false
+		}
+		opus = opus[extLen:]
+	}
+
+	p = &VoicePacket{
+		Sequence:  binary.BigEndian.Uint16(b[2:]),
+		Timestamp: binary.BigEndian.Uint32(b[4:]),
+		Opus:      opus,
+	}
+	return binary.BigEndian.Uint32(b[8:]), p, true
+}
+
+// stream returns the stream of the SSRC, creating it if needed.
+// It returns nil if we do not know the user of the SSRC yet, Discord
+// tells us with a Speaking payload before the user's audio.
+func (c *VoiceClient) stream(ssrc uint32) *VoiceStream {
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+	if s, ok := c.streams[ssrc]; ok {
+		return s
+	}
+	userID, ok := c.ssrcUsers[ssrc]
+	if !ok || c.StreamHandler == nil {
+		return nil
+	}
+	s := newVoiceStream(userID, ssrc)
+	c.streams[ssrc] = s
+	go c.StreamHandler(s)
+	return s
+}
+
+func (c *VoiceClient) onSpeaking(speaking *dataVoiceOpSpeaking) {
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+	if userID, ok := c.ssrcUsers[speaking.SSRC]; ok && userID != speaking.UserID {
+		// The SSRC was reused.
+		c.closeStream(speaking.SSRC)
+	}
+	c.ssrcUsers[speaking.SSRC] = speaking.UserID
+	if s, ok := c.streams[speaking.SSRC]; ok && !speaking.Speaking {
+		s.flush()
+	}
+}
+
+func (c *VoiceClient) onClientDisconnect(userID string) {
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+	for ssrc, userID2 := range c.ssrcUsers {
+		if userID2 == userID {
+			delete(c.ssrcUsers, ssrc)
+			c.closeStream(ssrc)
+		}
+	}
+}
+
+// closeStream is called with c.streamsMu locked.
+func (c *VoiceClient) closeStream(ssrc uint32) {
+	if s, ok := c.streams[ssrc]; ok {
+		delete(c.streams, ssrc)
+		s.close()
+	}
+}
+
+func (c *VoiceClient) closeStreams() {
+	c.streamsMu.Lock()
+	defer c.streamsMu.Unlock()
+	for ssrc := range c.streams {
+		c.closeStream(ssrc)
+	}
+}
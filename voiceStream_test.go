@@ -0,0 +1,129 @@
+package discgo
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nhooyr/discgo/discgotest"
+)
+
+func expectSequences(t *testing.T, s *VoiceStream, seqs ...uint16) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, seq := range seqs {
+		p, err := s.ReadPacket(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Sequence != seq {
+			t.Fatalf("expected sequence %v but got %v", seq, p.Sequence)
+		}
+	}
+	select {
+	case p := <-s.packets:
+		t.Fatalf("expected no more packets but got %v", p.Sequence)
+	default:
+	}
+}
+
+func TestVoiceStream_Reorder(t *testing.T) {
+	s := newVoiceStream("2", 2)
+	for _, seq := range []uint16{65534, 0, 65535, 1, 0, 65533} {
+		s.push(&VoicePacket{Sequence: seq})
+	}
+	expectSequences(t, s, 65534, 65535, 0, 1)
+}
+
+func TestVoiceStream_Gap(t *testing.T) {
+	s := newVoiceStream("2", 2)
+	s.push(&VoicePacket{Sequence: 1})
+	for seq := uint16(3); seq < 3+jitterBufferSize; seq++ {
+		s.push(&VoicePacket{Sequence: seq})
+	}
+	// Still waiting for 2.
+	expectSequences(t, s, 1)
+
+	s.push(&VoicePacket{Sequence: 3 + jitterBufferSize})
+	expectSequences(t, s, 3, 4, 5, 6, 7, 8)
+
+	// Too late.
+	s.push(&VoicePacket{Sequence: 2})
+	s.push(&VoicePacket{Sequence: 10})
+	expectSequences(t, s)
+	s.flush()
+	expectSequences(t, s, 10)
+
+	s.close()
+	_, err := s.ReadPacket(context.Background())
+	if err != io.EOF {
+		t.Fatalf("expected %v but got %v", io.EOF, err)
+	}
+}
+
+func TestVoiceClient_Receive(t *testing.T) {
+	streams := make(chan *VoiceStream, 1)
+	tv := newTestVoice(t, func(c *VoiceClient) {
+		c.StreamHandler = func(s *VoiceStream) {
+			streams <- s
+		}
+	})
+
+	err := tv.Speaking("2", 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The Speaking payload and the audio are not ordered.
+	for {
+		tv.c.streamsMu.Lock()
+		_, ok := tv.c.ssrcUsers[2]
+		tv.c.streamsMu.Unlock()
+		if ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, seq := range []uint16{10, 12, 11, 13} {
+		err = tv.SendPacket(&discgotest.VoicePacket{
+			Sequence:  seq,
+			Timestamp: uint32(seq) * opusFrameSamples,
+			SSRC:      2,
+			Opus:      []byte{byte(seq)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var s *VoiceStream
+	select {
+	case s = <-streams:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for stream")
+	}
+	if s.UserID != "2" || s.SSRC != 2 {
+		t.Fatalf("expected user %v with ssrc %v but got %v with %v", "2", 2, s.UserID, s.SSRC)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	for _, seq := range []uint16{10, 11, 12, 13} {
+		p, err := s.ReadPacket(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Sequence != seq || p.Timestamp != uint32(seq)*opusFrameSamples || p.Opus[0] != byte(seq) {
+			t.Fatalf("expected packet %v but got %+v", seq, p)
+		}
+	}
+
+	err = tv.ClientDisconnect("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.ReadPacket(ctx)
+	if err != io.EOF {
+		t.Fatalf("expected %v but got %v", io.EOF, err)
+	}
+}
@@ -10,3 +10,8 @@ type ModelWebhook struct {
 	Avatar    *string    `json:"avatar"`
 	Token     string     `json:"token"`
 }
+
+// WebhookURL returns the URL used to execute a webhook.
+func (c *RESTClient) WebhookURL(webhookID, webhookToken string) string {
+	return c.rootEndpoint().appendMajor("webhooks").appendMajor(webhookID).appendMinor(webhookToken).url
+}
@@ -0,0 +1,54 @@
+package discgo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+)
+
+// zlibSuffix ends every payload of a zlib-stream connection. It is the end of a sync flush.
+var zlibSuffix = []byte{0x00, 0x00, 0xFF, 0xFF}
+
+// zlibStream inflates a connection compressed with zlib-stream.
+// The connection is a single zlib stream so the inflate context must be kept across payloads.
+type zlibStream struct {
+	in  bytes.Buffer
+	zr  io.ReadCloser
+	buf []byte
+}
+
+// readFrom buffers a websocket message and returns whether it completed a payload.
+// A payload may be split across several messages.
+func (z *zlibStream) readFrom(r io.Reader) (complete bool, err error) {
+	_, err = z.in.ReadFrom(r)
+	if err != nil {
+		return false, err
+	}
+	return bytes.HasSuffix(z.in.Bytes(), zlibSuffix), nil
+}
+
+// inflate returns the buffered payload.
+// The decompressor sees an unexpected EOF if it is read from once all the input has been
+// consumed, so it is only read from while there is input. That is enough because buf is larger
+// than the decompressor's window; each Read returns all the output the decompressor has.
+func (z *zlibStream) inflate() ([]byte, error) {
+	if z.zr == nil {
+		var err error
+		// Reads the zlib header which is only at the start of the connection.
+		z.zr, err = zlib.NewReader(&z.in)
+		if err != nil {
+			return nil, err
+		}
+		z.buf = make([]byte, 64<<10)
+	}
+
+	var b []byte
+	for z.in.Len() > 0 {
+		n, err := z.zr.Read(z.buf)
+		b = append(b, z.buf[:n]...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
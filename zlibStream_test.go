@@ -0,0 +1,56 @@
+package discgo
+
+import (
+	"bytes"
+	"compress/zlib"
+	"strings"
+	"testing"
+)
+
+func TestZlibStream(t *testing.T) {
+	payloads := []string{
+		`{"op":10,"d":{"heartbeat_interval":41250}}`,
+		// Compressed with references to the previous payload.
+		`{"op":10,"d":{"heartbeat_interval":41250}}`,
+		// Larger than the decompressor's window.
+		`{"op":0,"d":"` + strings.Repeat("guild member ", 20000) + `"}`,
+		`{"op":11}`,
+	}
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	z := new(zlibStream)
+	for _, p := range payloads {
+		buf.Reset()
+		zw.Write([]byte(p))
+		err := zw.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Split into messages like Discord.
+		b := buf.Bytes()
+		for len(b) > 0 {
+			n := 100
+			if n > len(b) {
+				n = len(b)
+			}
+			complete, err := z.readFrom(bytes.NewReader(b[:n]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b = b[n:]
+			if complete != (len(b) == 0) {
+				t.Fatalf("expected complete to be %v but got %v", len(b) == 0, complete)
+			}
+		}
+
+		inflated, err := z.inflate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(inflated) != p {
+			t.Fatalf("expected %.50q but got %.50q", p, inflated)
+		}
+	}
+}